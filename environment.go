@@ -3,12 +3,18 @@ package wape
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,6 +24,7 @@ import (
 
 	wio "github.com/mymmrac/wape/host/io"
 	wnet "github.com/mymmrac/wape/host/net"
+	whttp "github.com/mymmrac/wape/host/net/http"
 )
 
 // Environment configures the behavior of WASM module.
@@ -177,11 +184,199 @@ type Environment struct {
 	// NetworksAllowAll allows all network protocols. Defaults to false.
 	NetworksAllowAll bool `json:"networksAllowAll,omitempty" yaml:"networksAllowAll,omitempty" toml:"networksAllowAll,omitempty"`
 
-	// NetworkAddressesAllowed configures the allowed network addresses. Defaults to none.
+	// NetworkAddressesAllowed configures the allowed network addresses. Supports host globs, CIDR blocks, port lists and
+	// ranges, for example "*.example.com:443", "10.0.0.0/8:*" or "api.example.com:80,8000-8100", see host/net.AddressRule
+	// for full syntax. Defaults to none.
 	NetworkAddressesAllowed []string `json:"networkAddressesAllowed,omitempty" yaml:"networkAddressesAllowed,omitempty" toml:"networkAddressesAllowed,omitempty"`
+	// NetworkAddressesDenied configures the denied network addresses, uses the same syntax as NetworkAddressesAllowed.
+	// Takes priority over allowed addresses, including NetworkAddressesAllowAll. Defaults to none.
+	NetworkAddressesDenied []string `json:"networkAddressesDenied,omitempty" yaml:"networkAddressesDenied,omitempty" toml:"networkAddressesDenied,omitempty"`
 	// NetworkAddressesAllowAll allows all network addresses. Defaults to false.
 	NetworkAddressesAllowAll bool `json:"networkAddressesAllowAll,omitempty" yaml:"networkAddressesAllowAll,omitempty" toml:"networkAddressesAllowAll,omitempty"`
 
+	// NetworkIPsAllowed configures the allowed IPs that dialed addresses are resolved to. Supports IPs, CIDR blocks and
+	// presets: "loopback", "private", "link-local", "multicast", "unspecified" and "internal" (all of them), see
+	// host/net.IPRule for full syntax. Checked after host name resolution, only vetted IPs are dialed, so DNS can't be used
+	// to bypass address rules. Defaults to all.
+	NetworkIPsAllowed []string `json:"networkIPsAllowed,omitempty" yaml:"networkIPsAllowed,omitempty" toml:"networkIPsAllowed,omitempty"`
+	// NetworkIPsDenied configures the denied IPs that dialed addresses are resolved to, uses the same syntax as
+	// NetworkIPsAllowed, for example, ["internal"] blocks access to loopback, private and link-local networks.
+	// Takes priority over allowed IPs. Defaults to none.
+	NetworkIPsDenied []string `json:"networkIPsDenied,omitempty" yaml:"networkIPsDenied,omitempty" toml:"networkIPsDenied,omitempty"`
+
+	// NetworkConnOptionsAllowed configures the socket options the guest can set on connections: "noDelay",
+	// "keepAlive", "keepAlivePeriod", "linger", "readBuffer", "writeBuffer" and "shutdown" (half-close of connections).
+	// Defaults to none.
+	NetworkConnOptionsAllowed []string `json:"networkConnOptionsAllowed,omitempty" yaml:"networkConnOptionsAllowed,omitempty" toml:"networkConnOptionsAllowed,omitempty"`
+	// NetworkConnOptionsAllowAll allows the guest to set all socket options. Defaults to false.
+	NetworkConnOptionsAllowAll bool `json:"networkConnOptionsAllowAll,omitempty" yaml:"networkConnOptionsAllowAll,omitempty" toml:"networkConnOptionsAllowAll,omitempty"`
+
+	// ListenFilter allows to create custom filtering for listen networks and addresses.
+	// Takes priority over listen networks and addresses configurations if present. Defaults to nil.
+	ListenFilter func(ctx context.Context, network, address string) (bool, error) `json:"-" yaml:"-" toml:"-"`
+
+	// ListenNetworksAllowed configures the allowed network protocols to listen on. See [net.Listen] for allowed
+	// protocols. Defaults to none.
+	ListenNetworksAllowed []string `json:"listenNetworksAllowed,omitempty" yaml:"listenNetworksAllowed,omitempty" toml:"listenNetworksAllowed,omitempty"`
+	// ListenNetworksAllowAll allows to listen on all network protocols. Defaults to false.
+	ListenNetworksAllowAll bool `json:"listenNetworksAllowAll,omitempty" yaml:"listenNetworksAllowAll,omitempty" toml:"listenNetworksAllowAll,omitempty"`
+
+	// ListenAddressesAllowed configures the allowed bind addresses, uses the same syntax as NetworkAddressesAllowed.
+	// Defaults to none.
+	ListenAddressesAllowed []string `json:"listenAddressesAllowed,omitempty" yaml:"listenAddressesAllowed,omitempty" toml:"listenAddressesAllowed,omitempty"`
+	// ListenAddressesAllowAll allows to bind on all addresses. Defaults to false.
+	ListenAddressesAllowAll bool `json:"listenAddressesAllowAll,omitempty" yaml:"listenAddressesAllowAll,omitempty" toml:"listenAddressesAllowAll,omitempty"`
+
+	// NetworkHosts configures static host names to IPs mapping used to resolve names for both dialing and guest
+	// lookups, takes priority over DNS. Defaults to none.
+	NetworkHosts map[string][]string `json:"networkHosts,omitempty" yaml:"networkHosts,omitempty" toml:"networkHosts,omitempty"`
+	// NetworkHostsFile configures static hosts from a file in hosts file format (see hosts(5)), merged with
+	// NetworkHosts. If the file can't be read, all lookups and dials fail. Defaults to none.
+	NetworkHostsFile string `json:"networkHostsFile,omitempty" yaml:"networkHostsFile,omitempty" toml:"networkHostsFile,omitempty"`
+	// NetworkHostsOnly disables DNS, only static hosts and IPs are resolved. Defaults to false.
+	NetworkHostsOnly bool `json:"networkHostsOnly,omitempty" yaml:"networkHostsOnly,omitempty" toml:"networkHostsOnly,omitempty"`
+
+	// NetworkUnixSockets maps guest Unix socket paths to host socket paths, so plugins can only reach chosen local
+	// sockets without exposing host paths. Guest paths ending with "/" map all sockets under them, for example
+	// {"/run/": "/var/run/wape/"}. If set, only mapped paths can be dialed on Unix networks, address rules are matched
+	// against guest paths. Defaults to none (guest paths are host paths).
+	NetworkUnixSockets map[string]string `json:"networkUnixSockets,omitempty" yaml:"networkUnixSockets,omitempty" toml:"networkUnixSockets,omitempty"`
+
+	// NetworkProxyURL configures upstream proxy that all TCP connections go through, supported schemes are "socks5",
+	// "http" and "https" (HTTP CONNECT), for example "socks5://proxy.internal:1080". Credentials can be passed as URL
+	// user info. Destinations are resolved by the host, so "socks5h" is not supported. Invalid URL fails all proxied
+	// dials. Defaults to no proxy.
+	NetworkProxyURL string `json:"networkProxyURL,omitempty" yaml:"networkProxyURL,omitempty" toml:"networkProxyURL,omitempty"`
+	// NetworkProxyUsername configures proxy username, takes priority over URL user info.
+	NetworkProxyUsername string `json:"networkProxyUsername,omitempty" yaml:"networkProxyUsername,omitempty" toml:"networkProxyUsername,omitempty"`
+	// NetworkProxyPassword configures proxy password, takes priority over URL user info.
+	NetworkProxyPassword string `json:"networkProxyPassword,omitempty" yaml:"networkProxyPassword,omitempty" toml:"networkProxyPassword,omitempty"`
+	// NetworkProxyBypass configures destinations that are dialed directly, see [wnet.AddressRule] for syntax. Rules are
+	// matched against both dialed addresses and resolved IPs. Defaults to none.
+	NetworkProxyBypass []string `json:"networkProxyBypass,omitempty" yaml:"networkProxyBypass,omitempty" toml:"networkProxyBypass,omitempty"`
+
+	// NetworkCassette records dialed connections or replays them without touching the network, see [wnet.Cassette].
+	// Takes priority over NetworkCassetteFile. Defaults to nil (no recording).
+	NetworkCassette *wnet.Cassette `json:"-" yaml:"-" toml:"-"`
+	// NetworkCassetteFile configures cassette file (JSON lines) that dialed connections are recorded into, the file is
+	// recreated for every set of host functions made from the environment and closed with the plugin. Instances created
+	// from the same compiled plugin share the cassette, their dials are recorded and replayed in the order they happen,
+	// so record and replay a single instance for reproducible replays. The cassette stores connection plaintext (TLS
+	// connections are recorded after handshake). Writes to NetworkCredentials destinations are recorded without data, so
+	// injected credentials are never stored, but other data sent by the guest and all responses are stored as is, review
+	// cassette files before committing or sharing them. Defaults to none.
+	NetworkCassetteFile string `json:"networkCassetteFile,omitempty" yaml:"networkCassetteFile,omitempty" toml:"networkCassetteFile,omitempty"`
+	// NetworkCassetteReplay replays connections from NetworkCassetteFile instead of recording them, dials without
+	// recorded connection fail. Defaults to false.
+	NetworkCassetteReplay bool `json:"networkCassetteReplay,omitempty" yaml:"networkCassetteReplay,omitempty" toml:"networkCassetteReplay,omitempty"`
+
+	// NetworkDialContext replaces dialing of the network, so the host can serve guest connections from in-process
+	// services (for example, one side of net.Pipe). Network and address policies are applied before it is called,
+	// addresses are passed as dialed by the guest. Defaults to nil (network is dialed).
+	NetworkDialContext func(ctx context.Context, network, address string) (net.Conn, error) `json:"-" yaml:"-" toml:"-"`
+	// NetworkHandlers configures HTTP handlers that serve guest connections to the addresses (for example,
+	// "api.internal:80") in memory, without real sockets. Takes priority over NetworkDialContext, network and address
+	// policies are applied as usual. Defaults to none.
+	NetworkHandlers map[string]http.Handler `json:"-" yaml:"-" toml:"-"`
+
+	// NetworkNamespace configures virtual network by name, plugins with the same namespace listen on virtual addresses
+	// and dial each other through in-memory pipes without touching the host network stack, see [wnet.Namespace].
+	// Listeners are always created in the namespace, dials to addresses without namespace listeners are refused (except
+	// NetworkHandlers) and packet connections are not supported. The namespace is shared by all plugins that use its
+	// name, including instances of the same compiled plugin, so they can't listen on the same address. Network and
+	// address policies and quotas are applied as usual, IP policy is not, as namespace addresses are never resolved to
+	// host IPs. Defaults to none.
+	NetworkNamespace string `json:"networkNamespace,omitempty" yaml:"networkNamespace,omitempty" toml:"networkNamespace,omitempty"`
+
+	// NetworkRewrites rewrites guest dial addresses before connecting, so plugins can use stable logical addresses and
+	// the host decides what they reach. Keys are guest addresses, address without port matches the host with any port.
+	// Values are targets, optionally prefixed with a network, target without port keeps the guest port, for example
+	// {"localhost:5432": "db.prod.internal:5432", "api:80": "unix:/run/api.sock"}. Network address rules are matched
+	// against guest addresses, IP rules against resolved targets. Defaults to none.
+	NetworkRewrites map[string]string `json:"networkRewrites,omitempty" yaml:"networkRewrites,omitempty" toml:"networkRewrites,omitempty"`
+
+	// NetworkTLSConfig is the base TLS configuration used for TLS connections dialed on the host. Defaults to nil.
+	NetworkTLSConfig *tls.Config `json:"-" yaml:"-" toml:"-"`
+
+	// NetworkTLSRootCAs configures root certificate authorities used to verify servers. Defaults to the host root CA set.
+	NetworkTLSRootCAs *x509.CertPool `json:"-" yaml:"-" toml:"-"`
+	// NetworkTLSRootCAsFile configures root certificate authorities from a PEM file, TLS connections fail if it can't
+	// be read or has no certificates.
+	NetworkTLSRootCAsFile string `json:"networkTLSRootCAsFile,omitempty" yaml:"networkTLSRootCAsFile,omitempty" toml:"networkTLSRootCAsFile,omitempty"`
+
+	// NetworkTLSClientCertificates configures client certificates for mutual TLS, never exposed to the guest.
+	// Defaults to none.
+	NetworkTLSClientCertificates []tls.Certificate `json:"-" yaml:"-" toml:"-"`
+	// NetworkTLSClientCertFile configures client certificate for mutual TLS from a PEM file, requires
+	// NetworkTLSClientKeyFile. TLS connections fail if the key pair can't be loaded.
+	NetworkTLSClientCertFile string `json:"networkTLSClientCertFile,omitempty" yaml:"networkTLSClientCertFile,omitempty" toml:"networkTLSClientCertFile,omitempty"`
+	// NetworkTLSClientKeyFile configures client private key for mutual TLS from a PEM file, requires
+	// NetworkTLSClientCertFile.
+	NetworkTLSClientKeyFile string `json:"networkTLSClientKeyFile,omitempty" yaml:"networkTLSClientKeyFile,omitempty" toml:"networkTLSClientKeyFile,omitempty"`
+
+	// NetworkTLSServerNames pins server names used for SNI and certificate verification per destination, keys are
+	// address rules matched against addresses dialed by the guest, for example {"*.internal:443": "gateway.internal"}.
+	// Defaults to the host of the dialed address.
+	NetworkTLSServerNames map[string]string `json:"networkTLSServerNames,omitempty" yaml:"networkTLSServerNames,omitempty" toml:"networkTLSServerNames,omitempty"`
+
+	// NetworkCredentials configures credentials that the host adds to egress traffic for matching destinations: headers,
+	// basic authentication and bearer tokens for HTTP requests executed on the host, client certificates for TLS
+	// performed on the host. Credentials never reach guest memory. The first credential matching the destination is
+	// used, invalid credentials fail all HTTP requests and TLS connections made by the host. Defaults to none.
+	NetworkCredentials []wnet.Credential `json:"networkCredentials,omitempty" yaml:"networkCredentials,omitempty" toml:"networkCredentials,omitempty"`
+
+	// ResolveFilter allows to create custom filtering for names resolved by the guest.
+	// Takes priority over resolve names configuration if present. Defaults to nil.
+	ResolveFilter func(ctx context.Context, name string) (bool, error) `json:"-" yaml:"-" toml:"-"`
+
+	// ResolveNamesAllowed configures the allowed names that the guest can resolve, uses the same syntax as
+	// NetworkAddressesAllowed, ports are ignored. Doesn't affect names resolved while dialing. Defaults to none.
+	ResolveNamesAllowed []string `json:"resolveNamesAllowed,omitempty" yaml:"resolveNamesAllowed,omitempty" toml:"resolveNamesAllowed,omitempty"`
+	// ResolveNamesAllowAll allows the guest to resolve all names. Defaults to false.
+	ResolveNamesAllowAll bool `json:"resolveNamesAllowAll,omitempty" yaml:"resolveNamesAllowAll,omitempty" toml:"resolveNamesAllowAll,omitempty"`
+
+	// HTTPURLsAllowed configures the allowed URLs for HTTP requests executed on the host, patterns are matched against
+	// scheme, host and path segments of URL, for example "https://*.example.com/v1/**", see
+	// [whttp.DoConfig.URLsAllowed] for syntax. Dial configuration is applied as well. Defaults to none.
+	HTTPURLsAllowed []string `json:"httpURLsAllowed,omitempty" yaml:"httpURLsAllowed,omitempty" toml:"httpURLsAllowed,omitempty"`
+	// HTTPURLsAllowAll allows all URLs for HTTP requests. Defaults to false.
+	HTTPURLsAllowAll bool `json:"httpURLsAllowAll,omitempty" yaml:"httpURLsAllowAll,omitempty" toml:"httpURLsAllowAll,omitempty"`
+
+	// HTTPMethodsAllowed configures the allowed methods for HTTP requests. Defaults to all.
+	HTTPMethodsAllowed []string `json:"httpMethodsAllowed,omitempty" yaml:"httpMethodsAllowed,omitempty" toml:"httpMethodsAllowed,omitempty"`
+
+	// HTTPHeadersAllowed configures the allowed headers for HTTP requests, other headers are removed. Defaults to all.
+	HTTPHeadersAllowed []string `json:"httpHeadersAllowed,omitempty" yaml:"httpHeadersAllowed,omitempty" toml:"httpHeadersAllowed,omitempty"`
+	// HTTPHeadersDenied configures the denied headers for HTTP requests that are removed. Takes priority over allowed
+	// headers. Defaults to none.
+	HTTPHeadersDenied []string `json:"httpHeadersDenied,omitempty" yaml:"httpHeadersDenied,omitempty" toml:"httpHeadersDenied,omitempty"`
+
+	// HTTPMaxRequestBodySize limits the body size of HTTP requests in bytes. Defaults to 0 (no limit).
+	HTTPMaxRequestBodySize int64 `json:"httpMaxRequestBodySize,omitempty" yaml:"httpMaxRequestBodySize,omitempty" toml:"httpMaxRequestBodySize,omitempty"`
+	// HTTPMaxResponseBodySize limits the body size of HTTP responses in bytes. Defaults to 0 (no limit).
+	HTTPMaxResponseBodySize int64 `json:"httpMaxResponseBodySize,omitempty" yaml:"httpMaxResponseBodySize,omitempty" toml:"httpMaxResponseBodySize,omitempty"`
+
+	// NetworkMaxConnections limits the number of concurrently open connections, including accepted and packet
+	// connections. Network limits are tracked per plugin instance, instances created from the same compiled plugin
+	// don't share them. Defaults to 0 (no limit).
+	NetworkMaxConnections int `json:"networkMaxConnections,omitempty" yaml:"networkMaxConnections,omitempty" toml:"networkMaxConnections,omitempty"`
+	// NetworkMaxBytesIn limits the total number of bytes read from all connections. Defaults to 0 (no limit).
+	NetworkMaxBytesIn int64 `json:"networkMaxBytesIn,omitempty" yaml:"networkMaxBytesIn,omitempty" toml:"networkMaxBytesIn,omitempty"`
+	// NetworkMaxBytesOut limits the total number of bytes written to all connections. Defaults to 0 (no limit).
+	NetworkMaxBytesOut int64 `json:"networkMaxBytesOut,omitempty" yaml:"networkMaxBytesOut,omitempty" toml:"networkMaxBytesOut,omitempty"`
+	// NetworkMaxConnBytesIn limits the number of bytes read from a single connection. Defaults to 0 (no limit).
+	NetworkMaxConnBytesIn int64 `json:"networkMaxConnBytesIn,omitempty" yaml:"networkMaxConnBytesIn,omitempty" toml:"networkMaxConnBytesIn,omitempty"`
+	// NetworkMaxConnBytesOut limits the number of bytes written to a single connection. Defaults to 0 (no limit).
+	NetworkMaxConnBytesOut int64 `json:"networkMaxConnBytesOut,omitempty" yaml:"networkMaxConnBytesOut,omitempty" toml:"networkMaxConnBytesOut,omitempty"`
+	// NetworkRateLimitIn limits the read bandwidth of all connections in bytes per second. Defaults to 0 (no limit).
+	NetworkRateLimitIn int64 `json:"networkRateLimitIn,omitempty" yaml:"networkRateLimitIn,omitempty" toml:"networkRateLimitIn,omitempty"`
+	// NetworkRateLimitOut limits the write bandwidth of all connections in bytes per second. Defaults to 0 (no limit).
+	NetworkRateLimitOut int64 `json:"networkRateLimitOut,omitempty" yaml:"networkRateLimitOut,omitempty" toml:"networkRateLimitOut,omitempty"`
+	// NetworkIdleTimeout closes connections that have no reads or writes for the duration. Defaults to 0 (no limit).
+	NetworkIdleTimeout time.Duration `json:"networkIdleTimeout,omitempty" yaml:"networkIdleTimeout,omitempty" toml:"networkIdleTimeout,omitempty"`
+	// NetworkMaxConnLifetime closes connections that are open for longer than the duration. Defaults to 0 (no limit).
+	NetworkMaxConnLifetime time.Duration `json:"networkMaxConnLifetime,omitempty" yaml:"networkMaxConnLifetime,omitempty" toml:"networkMaxConnLifetime,omitempty"`
+
 	// ==== WASI ====
 
 	// DisableWASI disables WASI Preview 1 support. Defaults to false.
@@ -524,28 +719,242 @@ func (e *Environment) MakePluginConfig() extism.PluginConfig {
 	}
 }
 
-// MakeHostFunctions returns the host functions based on the environment.
+// MakeHostFunctions returns the host functions based on the environment. Cassette file configured by
+// NetworkCassetteFile stays open, prefer [NewPlugin] and [NewCompiledPlugin] that close it with the plugin. Invalid
+// network configuration (like malformed address rules) is not reported, host functions deny everything instead, while
+// [NewPlugin] and [NewCompiledPlugin] return the error.
+//
+// Plugins created directly by [extism.NewPlugin] or [extism.CompiledPlugin.Instance] are not registered by wape, so
+// host functions that open connections, listeners or IO handles fail for them with the "not registered" error code,
+// as resources would never be closed. Use [NewPlugin] or [NewPluginInstance] to create plugins with network access.
 func (e *Environment) MakeHostFunctions() []extism.HostFunction {
+	functions, _, _ := e.makeHostFunctions()
+	return functions
+}
+
+// makeHostFunctions returns the host functions based on the environment and closers of resources opened for them.
+// Returns an error if the network configuration is invalid, host functions are still created, they fail closed.
+func (e *Environment) makeHostFunctions() ([]extism.HostFunction, []io.Closer, error) {
 	functions := make([]extism.HostFunction, 0, len(e.HostFunctions))
+	var (
+		closers []io.Closer
+		err     error
+	)
 
 	if e.NetworkEnabled {
 		functions = append(functions, wio.Ready())
+		functions = append(functions, wio.Wait())
+		functions = append(functions, wio.Poll())
+		functions = append(functions, wio.Cancel())
+		functions = append(functions, wio.LastError())
 	}
 
 	if e.NetworkEnabled {
-		functions = append(functions, wnet.LookupHost())
-		functions = append(functions, wnet.Dial(wnet.DialConfig{
+		quota := e.makeNetworkQuota()
+		namespace := e.makeNetworkNamespace()
+
+		cassette := e.makeNetworkCassette()
+		if cassette != e.NetworkCassette {
+			closers = append(closers, cassette)
+		}
+
+		dialConfig := wnet.DialConfig{
 			NetworkFilter:            e.NetworkFilter,
 			NetworksAllowed:          e.NetworksAllowed,
 			NetworksAllowAll:         e.NetworksAllowAll,
 			NetworkAddressesAllowed:  e.NetworkAddressesAllowed,
+			NetworkAddressesDenied:   e.NetworkAddressesDenied,
 			NetworkAddressesAllowAll: e.NetworkAddressesAllowAll,
-		}))
+			NetworkIPsAllowed:        e.NetworkIPsAllowed,
+			NetworkIPsDenied:         e.NetworkIPsDenied,
+			Hosts:                    e.NetworkHosts,
+			HostsFile:                e.NetworkHostsFile,
+			HostsOnly:                e.NetworkHostsOnly,
+			UnixSockets:              e.NetworkUnixSockets,
+			Proxy:                    e.makeNetworkProxy(),
+			Cassette:                 cassette,
+			DialContext:              e.NetworkDialContext,
+			Handlers:                 e.NetworkHandlers,
+			Namespace:                namespace,
+			Rewrites:                 e.NetworkRewrites,
+			Credentials:              e.makeNetworkCredentials(),
+			Quota:                    quota,
+		}
+
+		listenConfig := wnet.ListenConfig{
+			ListenFilter:            e.ListenFilter,
+			ListenNetworksAllowed:   e.ListenNetworksAllowed,
+			ListenNetworksAllowAll:  e.ListenNetworksAllowAll,
+			ListenAddressesAllowed:  e.ListenAddressesAllowed,
+			ListenAddressesAllowAll: e.ListenAddressesAllowAll,
+			Quota:                   quota,
+			Namespace:               namespace,
+		}
+
+		tlsConfig := e.makeTLSConfig()
+
+		connOptionConfig := wnet.ConnOptionConfig{
+			OptionsAllowed:  e.NetworkConnOptionsAllowed,
+			OptionsAllowAll: e.NetworkConnOptionsAllowAll,
+		}
+
+		resolverConfig := wnet.ResolverConfig{
+			ResolveFilter:        e.ResolveFilter,
+			ResolveNamesAllowed:  e.ResolveNamesAllowed,
+			ResolveNamesAllowAll: e.ResolveNamesAllowAll,
+			Hosts:                e.NetworkHosts,
+			HostsFile:            e.NetworkHostsFile,
+			HostsOnly:            e.NetworkHostsOnly,
+		}
+
+		doConfig := whttp.DoConfig{
+			URLsAllowed:         e.HTTPURLsAllowed,
+			URLsAllowAll:        e.HTTPURLsAllowAll,
+			MethodsAllowed:      e.HTTPMethodsAllowed,
+			HeadersAllowed:      e.HTTPHeadersAllowed,
+			HeadersDenied:       e.HTTPHeadersDenied,
+			MaxRequestBodySize:  e.HTTPMaxRequestBodySize,
+			MaxResponseBodySize: e.HTTPMaxResponseBodySize,
+		}
+
+		// Dial and resolver configurations share static hosts, so their errors are reported once
+		err = joinUniqueErrors(dialConfig.Validate(), listenConfig.Validate(), resolverConfig.Validate(),
+			tlsConfig.Validate(), connOptionConfig.Validate(), doConfig.Validate())
+		if err != nil {
+			err = fmt.Errorf("invalid network configuration: %w", err)
+		}
+
+		functions = append(functions, wnet.LookupHost(resolverConfig))
+		functions = append(functions, wnet.LookupIP(resolverConfig))
+		functions = append(functions, wnet.LookupSRV(resolverConfig))
+		functions = append(functions, wnet.LookupTXT(resolverConfig))
+		functions = append(functions, wnet.LookupMX(resolverConfig))
+		functions = append(functions, wnet.LookupCNAME(resolverConfig))
+		functions = append(functions, wnet.Dial(dialConfig))
+		functions = append(functions, wnet.DialTLS(dialConfig, tlsConfig))
 		functions = append(functions, wnet.ConnRead())
 		functions = append(functions, wnet.ConnWrite())
 		functions = append(functions, wnet.ConnClose())
+		functions = append(functions, wnet.ConnSetDeadline())
+		functions = append(functions, wnet.ConnLocalAddr())
+		functions = append(functions, wnet.ConnRemoteAddr())
+		functions = append(functions, wnet.ConnSetOption(connOptionConfig))
+		functions = append(functions, wnet.ConnShutdown(connOptionConfig))
+		functions = append(functions, wnet.Listen(listenConfig))
+		functions = append(functions, wnet.ListenerAccept(listenConfig))
+		functions = append(functions, wnet.ListenerClose())
+		functions = append(functions, wnet.ListenerAddr())
+		functions = append(functions, wnet.ListenPacket(listenConfig))
+		functions = append(functions, wnet.PacketConnReadFrom())
+		functions = append(functions, wnet.PacketConnReadFromAddress())
+		functions = append(functions, wnet.PacketConnWriteTo(dialConfig))
+		functions = append(functions, wnet.PacketConnClose())
+		functions = append(functions, wnet.PacketConnSetDeadline())
+		functions = append(functions, wnet.PacketConnLocalAddr())
+		functions = append(functions, whttp.Do(doConfig, dialConfig, tlsConfig))
 	}
 
 	functions = append(functions, e.HostFunctions...)
-	return functions
+	return functions, closers, err
+}
+
+// joinUniqueErrors joins errors skipping ones with the same message, see [errors.Join].
+func joinUniqueErrors(errs ...error) error {
+	var unique []error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		for _, joined := range flattenErrors(err) {
+			if !slices.ContainsFunc(unique, func(other error) bool { return other.Error() == joined.Error() }) {
+				unique = append(unique, joined)
+			}
+		}
+	}
+	return errors.Join(unique...)
+}
+
+// flattenErrors returns errors joined by [errors.Join] or the error itself.
+func flattenErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// makeTLSConfig returns the TLS configuration based on the environment.
+func (e *Environment) makeTLSConfig() wnet.TLSConfig {
+	return wnet.TLSConfig{
+		Config:             e.NetworkTLSConfig,
+		RootCAs:            e.NetworkTLSRootCAs,
+		RootCAsFile:        e.NetworkTLSRootCAsFile,
+		ClientCertificates: e.NetworkTLSClientCertificates,
+		ClientCertFile:     e.NetworkTLSClientCertFile,
+		ClientKeyFile:      e.NetworkTLSClientKeyFile,
+		ServerNames:        e.NetworkTLSServerNames,
+	}
+}
+
+// makeNetworkProxy returns the upstream proxy based on the environment, returns nil if proxy is not configured.
+func (e *Environment) makeNetworkProxy() *wnet.Proxy {
+	if e.NetworkProxyURL == "" {
+		return nil
+	}
+	return wnet.NewProxy(wnet.ProxyConfig{
+		URL:      e.NetworkProxyURL,
+		Username: e.NetworkProxyUsername,
+		Password: e.NetworkProxyPassword,
+		Bypass:   e.NetworkProxyBypass,
+	})
+}
+
+// makeNetworkCassette returns the network cassette based on the environment, returns nil if cassette is not configured.
+func (e *Environment) makeNetworkCassette() *wnet.Cassette {
+	switch {
+	case e.NetworkCassette != nil:
+		return e.NetworkCassette
+	case e.NetworkCassetteFile != "":
+		return wnet.OpenCassette(e.NetworkCassetteFile, e.NetworkCassetteReplay)
+	default:
+		return nil
+	}
+}
+
+// makeNetworkNamespace returns the virtual network namespace based on the environment, returns nil if namespace is not
+// configured.
+func (e *Environment) makeNetworkNamespace() *wnet.Namespace {
+	if e.NetworkNamespace == "" {
+		return nil
+	}
+	return wnet.LookupNamespace(e.NetworkNamespace)
+}
+
+// makeNetworkCredentials returns the egress credentials based on the environment, returns nil if there are no
+// credentials.
+func (e *Environment) makeNetworkCredentials() *wnet.Credentials {
+	if len(e.NetworkCredentials) == 0 {
+		return nil
+	}
+	return wnet.NewCredentials(e.NetworkCredentials)
+}
+
+// makeNetworkQuota returns the network quota based on the environment, returns nil if there are no limits.
+func (e *Environment) makeNetworkQuota() *wnet.Quota {
+	cfg := wnet.QuotaConfig{
+		MaxConnections:  e.NetworkMaxConnections,
+		MaxBytesIn:      e.NetworkMaxBytesIn,
+		MaxBytesOut:     e.NetworkMaxBytesOut,
+		MaxConnBytesIn:  e.NetworkMaxConnBytesIn,
+		MaxConnBytesOut: e.NetworkMaxConnBytesOut,
+		RateLimitIn:     e.NetworkRateLimitIn,
+		RateLimitOut:    e.NetworkRateLimitOut,
+		IdleTimeout:     e.NetworkIdleTimeout,
+		MaxConnLifetime: e.NetworkMaxConnLifetime,
+	}
+	if cfg == (wnet.QuotaConfig{}) {
+		return nil
+	}
+	cfg.PerPlugin = true
+	return wnet.NewQuota(cfg)
 }
@@ -29,8 +29,6 @@ func main() {
 	env.StdinFromHost = true
 	env.StdoutFromHost = true
 
-	env.FSFromHost = true
-
 	env.WallTimeFromHost = true
 	env.NanoTimeFromHost = true
 	env.NanoSleepFromHost = true
@@ -45,7 +43,7 @@ func main() {
 
 	assert(err == nil, err)
 
-	plugin, err := cmPlugin.Instance(ctx, env.MakePluginInstanceConfig())
+	plugin, err := wape.NewPluginInstance(ctx, cmPlugin, env)
 	assert(err == nil, err)
 
 	exit, _, err := plugin.CallWithContext(ctx, "main", nil)
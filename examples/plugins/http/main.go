@@ -1,12 +1,9 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/mymmrac/wape/plugin/net"
@@ -14,24 +11,9 @@ import (
 
 //go:wasmexport main
 func main() {
-	certPool := x509.NewCertPool()
-
-	data, err := os.ReadFile("/etc/ssl/certs/ca-certificates.crt")
-	if err != nil {
-		fmt.Println("Error read cert:", err)
-		return
-	}
-
-	if !certPool.AppendCertsFromPEM(data) {
-		fmt.Println("Invalid cert")
-		return
-	}
-
 	tr := http.DefaultTransport.(*http.Transport).Clone()
 	tr.DialContext = net.DefaultDialer.DialContext
-	tr.TLSClientConfig = &tls.Config{
-		RootCAs: certPool,
-	}
+	tr.DialTLSContext = net.DefaultDialer.DialTLSContext
 
 	client := &http.Client{
 		Transport: tr,
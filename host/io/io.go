@@ -2,31 +2,225 @@ package io
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
 
 	extism "github.com/extism/go-sdk"
 
 	"github.com/mymmrac/wape/internal"
 )
 
-// Ready returns a host function that waits for IO to finish.
+// Ready returns a host function that checks if IO is finished without blocking.
+// Returns zero if IO is pending, error code if IO failed, otherwise the number of bytes processed (or ID of created
+// resource) plus one, see [internal.IOResult.Code]. Error of finished IO is recorded as the last error, see
+// [LastError].
 func Ready() extism.HostFunction {
 	return internal.NewHostFunction("io.ready",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
 			handle := extism.DecodeI32(stack[0])
 
-			result, ok := internal.IOHandles.GetOk(handle)
+			resources := internal.PluginResources(ctx)
+			op, ok := resources.IOHandles.Get(handle)
 			if !ok {
-				stack[0] = extism.EncodeI32(-1)
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
 				return
 			}
 
-			stack[0] = extism.EncodeI32(result)
+			stack[0] = extism.EncodeI32(result(p, resources, handle, op))
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle */},
+		[]extism.ValueType{extism.ValueTypeI32 /* result | errorCode */},
+	)
+}
 
-			if result != 0 {
-				internal.IOHandles.Delete(handle)
+// Wait returns a host function that blocks until IO is finished or timeout expires, returns the same result as
+// [Ready]. Timeout is passed in nanoseconds, zero means don't block and negative value means no timeout.
+func Wait() extism.HostFunction {
+	return internal.NewHostFunction("io.wait",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			handle := extism.DecodeI32(stack[0])
+			timeout := int64(stack[1])
+
+			resources := internal.PluginResources(ctx)
+			op, ok := resources.IOHandles.Get(handle)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			if timeout != 0 {
+				timer, stop := newTimer(timeout)
+				select {
+				case <-op.Done():
+				case <-timer:
+				case <-ctx.Done():
+				}
+				stop()
 			}
+
+			stack[0] = extism.EncodeI32(result(p, resources, handle, op))
 		},
-		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle */},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle */, extism.ValueTypeI64 /* timeout */},
 		[]extism.ValueType{extism.ValueTypeI32 /* result | errorCode */},
 	)
 }
+
+// Poll returns a host function that blocks until any of IO operations is finished or timeout expires.
+// Handles are passed as little-endian encoded list of int32, returns the index of the first finished handle or
+// deadline exceeded error code if timeout expires. Handles are not consumed, use [Ready] to get the result of the
+// finished IO. Timeout is passed the same way as for [Wait].
+func Poll() extism.HostFunction {
+	return internal.NewHostFunction("io.poll",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			timeout := int64(stack[1])
+
+			handlesData, err := internal.ReadBytes(p, stack[0])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+			if len(handlesData)%4 != 0 {
+				stack[0] = extism.EncodeI32(resources.Fail(
+					fmt.Errorf("%w: handles length is not a multiple of 4", internal.ErrInvalidArgument)))
+				return
+			}
+
+			cases := make([]reflect.SelectCase, 0, len(handlesData)/4+2)
+			for i := 0; i < len(handlesData); i += 4 {
+				handle := int32(binary.LittleEndian.Uint32(handlesData[i:]))
+				op, ok := resources.IOHandles.Get(handle)
+				if !ok {
+					stack[0] = extism.EncodeI32(resources.Fail(
+						fmt.Errorf("%w: %d", internal.ErrInvalidHandle, handle)))
+					return
+				}
+
+				if op.Result().Done {
+					stack[0] = extism.EncodeI32(int32(i / 4))
+					return
+				}
+
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(op.Done())})
+			}
+			handlesCount := len(cases)
+
+			if timeout == 0 {
+				stack[0] = extism.EncodeI32(resources.Fail(os.ErrDeadlineExceeded))
+				return
+			}
+
+			timer, stop := newTimer(timeout)
+			defer stop()
+
+			cases = append(cases,
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer)},
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			)
+
+			chosen, _, _ := reflect.Select(cases)
+			switch {
+			case chosen < handlesCount:
+				stack[0] = extism.EncodeI32(int32(chosen))
+			case chosen == handlesCount:
+				stack[0] = extism.EncodeI32(resources.Fail(os.ErrDeadlineExceeded))
+			default:
+				stack[0] = extism.EncodeI32(resources.Fail(ctx.Err()))
+			}
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* ioHandles */, extism.ValueTypeI64 /* timeout */},
+		[]extism.ValueType{extism.ValueTypeI32 /* index | errorCode */},
+	)
+}
+
+// Cancel returns a host function that cancels pending IO, interrupting it if possible. Canceled IO is finished with
+// canceled error code, its result still has to be collected with [Ready], [Wait] or [Poll]. Canceling finished IO has
+// no effect.
+func Cancel() extism.HostFunction {
+	return internal.NewHostFunction("io.cancel",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			handle := extism.DecodeI32(stack[0])
+
+			resources := internal.PluginResources(ctx)
+			op, ok := resources.IOHandles.Get(handle)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			op.Cancel()
+			stack[0] = 0
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle */},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// LastError returns a host function that returns and clears the last error of host functions.
+// Error is encoded as error code and message separated by a space, zero pointer is returned if there is no error.
+// Only description is returned for DNS and network operation errors, as the guest wraps them with its own context.
+func LastError() extism.HostFunction {
+	return internal.NewHostFunction("io.lastError",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			err := internal.PluginResources(ctx).LastError()
+			if err == nil {
+				stack[0] = 0
+				return
+			}
+
+			message := err.Error()
+			var (
+				opErr  *net.OpError
+				dnsErr *net.DNSError
+			)
+			if errors.As(err, &dnsErr) {
+				message = dnsErr.Err
+			} else if errors.As(err, &opErr) {
+				message = opErr.Err.Error()
+			}
+
+			errPtr, err := p.WriteString(strconv.Itoa(int(internal.ErrorCode(err))) + " " + message)
+			if err != nil {
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = errPtr
+		},
+		[]extism.ValueType{},
+		[]extism.ValueType{extism.ValueTypePTR /* error */},
+	)
+}
+
+// result collects the result of IO, finished IO is removed and its error is recorded as the last error. Result code of
+// finished IO is never zero, so the handle is removed only when the guest sees that IO is finished.
+func result(p *extism.CurrentPlugin, resources *internal.Resources, handle int32, op *internal.IOOperation) int32 {
+	ioResult := op.Collect(p)
+	if !ioResult.Done {
+		return 0
+	}
+	resources.IOHandles.Remove(handle)
+
+	code := ioResult.Code()
+	if code < 0 {
+		resources.Fail(ioResult.Err)
+	}
+
+	return code
+}
+
+// newTimer returns a channel that fires after timeout in nanoseconds, negative timeout never fires.
+func newTimer(timeout int64) (<-chan time.Time, func()) {
+	if timeout < 0 {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(time.Duration(timeout))
+	return timer.C, func() { timer.Stop() }
+}
@@ -0,0 +1,147 @@
+package net
+
+import (
+	"context"
+	"net"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// ConnLocalAddr returns the local network address of a connection.
+// Address is encoded as network and address separated by a space, see [encodeAddr].
+func ConnLocalAddr() extism.HostFunction {
+	return internal.NewHostFunction("net.conn.localAddr",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			connectionID := extism.DecodeI32(stack[0])
+
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				resources.Fail(internal.ErrInvalidHandle)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeAddr(p, resources, conn.LocalAddr())
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* connectionID */},
+		[]extism.ValueType{extism.ValueTypePTR /* address */},
+	)
+}
+
+// ConnRemoteAddr returns the remote network address of a connection.
+// Address is encoded the same way as for [ConnLocalAddr].
+func ConnRemoteAddr() extism.HostFunction {
+	return internal.NewHostFunction("net.conn.remoteAddr",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			connectionID := extism.DecodeI32(stack[0])
+
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				resources.Fail(internal.ErrInvalidHandle)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeAddr(p, resources, conn.RemoteAddr())
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* connectionID */},
+		[]extism.ValueType{extism.ValueTypePTR /* address */},
+	)
+}
+
+// ListenerAddr returns the network address of a listener.
+// Address is encoded the same way as for [ConnLocalAddr].
+func ListenerAddr() extism.HostFunction {
+	return internal.NewHostFunction("net.listener.addr",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			listenerID := extism.DecodeI32(stack[0])
+
+			listener, ok := resources.Listeners.Get(listenerID)
+			if !ok {
+				resources.Fail(internal.ErrInvalidHandle)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeAddr(p, resources, listener.Addr())
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* listenerID */},
+		[]extism.ValueType{extism.ValueTypePTR /* address */},
+	)
+}
+
+// PacketConnLocalAddr returns the local network address of a packet connection.
+// Address is encoded the same way as for [ConnLocalAddr].
+func PacketConnLocalAddr() extism.HostFunction {
+	return internal.NewHostFunction("net.packetConn.localAddr",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			packetConnID := extism.DecodeI32(stack[0])
+
+			packetConn, ok := resources.PacketConnections.Get(packetConnID)
+			if !ok {
+				resources.Fail(internal.ErrInvalidHandle)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeAddr(p, resources, packetConn.LocalAddr())
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* packetConnectionID */},
+		[]extism.ValueType{extism.ValueTypePTR /* address */},
+	)
+}
+
+// writeAddr writes encoded address into plugin memory, returns zero pointer for nil address or on error.
+func writeAddr(p *extism.CurrentPlugin, resources *internal.Resources, addr net.Addr) uint64 {
+	if addr == nil {
+		return 0
+	}
+
+	addrPtr, err := p.WriteString(encodeAddr(addr))
+	if err != nil {
+		resources.Fail(err)
+		return 0
+	}
+
+	return addrPtr
+}
+
+// encodeAddr encodes address as network and address separated by a space.
+func encodeAddr(addr net.Addr) string {
+	return addr.Network() + " " + addr.String()
+}
+
+// genericAddr is a network address that is not backed by a socket.
+type genericAddr struct {
+	network string
+	address string
+}
+
+func (a *genericAddr) Network() string {
+	return a.network
+}
+
+func (a *genericAddr) String() string {
+	return a.address
+}
+
+// addrConn is a connection that reports the address dialed by the guest as its remote address, so host addresses are
+// not exposed to the guest.
+type addrConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *addrConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,198 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// AddressRule is a rule that matches network addresses.
+//
+// Rule consists of host and optional port separated by a colon, IPv6 hosts must be enclosed in square brackets if
+// port is present. Host can be an exact host name or IP ("example.com", "10.0.0.1", "[::1]"), a glob pattern, see
+// [path.Match] ("*.example.com", "*") or a CIDR block ("10.0.0.0/8", "[fd00::/8]"). Port can be an exact port
+// ("443"), any port ("*"), a port range ("8000-8100") or a comma separated list of them ("80,443,8000-8100"). Rule
+// without port matches any port. Addresses that don't have a host and port (for example, Unix socket paths) are matched
+// by rules starting with "/" or "@", glob patterns are supported ("/var/run/*.sock").
+type AddressRule struct {
+	raw    string
+	path   string
+	host   string
+	ip     netip.Addr
+	prefix netip.Prefix
+	ports  []portRange
+}
+
+// portRange is an inclusive range of ports.
+type portRange struct {
+	from uint16
+	to   uint16
+}
+
+// ParseAddressRule parses address rule, see [AddressRule] for syntax.
+func ParseAddressRule(rule string) (AddressRule, error) {
+	r := AddressRule{
+		raw: rule,
+	}
+
+	if strings.HasPrefix(rule, "/") || strings.HasPrefix(rule, "@") {
+		if _, err := path.Match(rule, ""); err != nil {
+			return AddressRule{}, fmt.Errorf("invalid address rule %q: %w", rule, err)
+		}
+		r.path = rule
+		return r, nil
+	}
+
+	host, ports, err := splitAddressRule(rule)
+	if err != nil {
+		return AddressRule{}, fmt.Errorf("invalid address rule %q: %w", rule, err)
+	}
+
+	switch {
+	case strings.Contains(host, "/"):
+		r.prefix, err = netip.ParsePrefix(host)
+		if err != nil {
+			return AddressRule{}, fmt.Errorf("invalid address rule %q: %w", rule, err)
+		}
+		r.prefix = r.prefix.Masked()
+	default:
+		if ip, ipErr := netip.ParseAddr(host); ipErr == nil {
+			r.ip = ip.Unmap()
+			break
+		}
+
+		r.host = normalizeHost(host)
+		if _, err = path.Match(r.host, ""); err != nil {
+			return AddressRule{}, fmt.Errorf("invalid address rule %q: %w", rule, err)
+		}
+	}
+
+	if ports != "" && ports != "*" {
+		for part := range strings.SplitSeq(ports, ",") {
+			var pr portRange
+			pr, err = parsePortRange(part)
+			if err != nil {
+				return AddressRule{}, fmt.Errorf("invalid address rule %q: %w", rule, err)
+			}
+			r.ports = append(r.ports, pr)
+		}
+	}
+
+	return r, nil
+}
+
+// String returns the rule as it was parsed.
+func (r AddressRule) String() string {
+	return r.raw
+}
+
+// Match reports whether the address matches the rule.
+func (r AddressRule) Match(address string) bool {
+	if r.path != "" {
+		matched, _ := path.Match(r.path, address)
+		return matched
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	return r.matchHost(host) && r.matchPort(port)
+}
+
+// matchHost reports whether the host matches the rule.
+func (r AddressRule) matchHost(host string) bool {
+	switch {
+	case r.prefix.IsValid():
+		ip, err := netip.ParseAddr(host)
+		return err == nil && r.prefix.Contains(ip.Unmap())
+	case r.ip.IsValid():
+		ip, err := netip.ParseAddr(host)
+		return err == nil && ip.Unmap() == r.ip
+	default:
+		matched, _ := path.Match(r.host, normalizeHost(host))
+		return matched
+	}
+}
+
+// matchPort reports whether the port matches the rule.
+func (r AddressRule) matchPort(port string) bool {
+	if len(r.ports) == 0 {
+		return true
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return false
+	}
+
+	for _, pr := range r.ports {
+		if uint16(p) >= pr.from && uint16(p) <= pr.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitAddressRule splits address rule into host and ports parts.
+func splitAddressRule(rule string) (host, ports string, err error) {
+	if strings.HasPrefix(rule, "[") {
+		end := strings.Index(rule, "]")
+		if end < 0 {
+			return "", "", fmt.Errorf("missing ']' in host")
+		}
+
+		host, ports = rule[1:end], rule[end+1:]
+		if ports == "" {
+			return host, "", nil
+		}
+		if !strings.HasPrefix(ports, ":") {
+			return "", "", fmt.Errorf("unexpected %q after host", ports)
+		}
+
+		return host, ports[1:], nil
+	}
+
+	// IPv6 address or CIDR block without port
+	if strings.Count(rule, ":") > 1 {
+		return rule, "", nil
+	}
+
+	host, ports, _ = strings.Cut(rule, ":")
+	return host, ports, nil
+}
+
+// parsePortRange parses a single port or a port range.
+func parsePortRange(s string) (portRange, error) {
+	fromStr, toStr, isRange := strings.Cut(s, "-")
+
+	from, err := strconv.ParseUint(fromStr, 10, 16)
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid port %q", fromStr)
+	}
+
+	if !isRange {
+		return portRange{from: uint16(from), to: uint16(from)}, nil
+	}
+
+	to, err := strconv.ParseUint(toStr, 10, 16)
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid port %q", toStr)
+	}
+
+	if from > to {
+		return portRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+
+	return portRange{from: uint16(from), to: uint16(to)}, nil
+}
+
+// normalizeHost normalizes host name for comparison.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
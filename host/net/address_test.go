@@ -0,0 +1,140 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+func TestParseAddressRuleInvalid(t *testing.T) {
+	rules := []string{
+		"[::1",
+		"[::1]80",
+		"example.com:http",
+		"example.com:8100-8000",
+		"example.com:70000",
+		"example.com:80,",
+		"10.0.0.0/33",
+		"[fd00::/129]:80",
+		"[a-",
+		"/var/run/[a-",
+	}
+
+	for _, rule := range rules {
+		if _, err := ParseAddressRule(rule); err == nil {
+			t.Errorf("expected error for rule %q", rule)
+		}
+	}
+}
+
+func TestAddressRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule    string
+		address string
+		match   bool
+	}{
+		// Exact hosts, case and trailing dot are normalized
+		{"example.com", "example.com:443", true},
+		{"example.com", "EXAMPLE.com.:443", true},
+		{"example.com.", "example.com:443", true},
+		{"example.com", "api.example.com:443", false},
+		{"example.com", "example.com", false},
+
+		// Host globs
+		{"*.example.com", "api.example.com:443", true},
+		{"*.example.com", "API.Example.COM.:443", true},
+		{"*.example.com", "example.com:443", false},
+		{"*.example.com", "a.b.example.com:443", true},
+		{"*", "anything:1", true},
+		{"api-?.example.com", "api-1.example.com:80", true},
+
+		// Ports, lists and ranges
+		{"example.com:443", "example.com:443", true},
+		{"example.com:443", "example.com:80", false},
+		{"example.com:*", "example.com:80", true},
+		{"example.com:80,443", "example.com:443", true},
+		{"example.com:80,443", "example.com:8080", false},
+		{"example.com:8000-8100", "example.com:8000", true},
+		{"example.com:8000-8100", "example.com:8100", true},
+		{"example.com:8000-8100", "example.com:8101", false},
+		{"example.com:80,8000-8100", "example.com:8050", true},
+		{"example.com:80", "example.com:http", false},
+
+		// IPs, IPv4-mapped IPv6 addresses match IPv4 rules
+		{"10.0.0.1", "10.0.0.1:80", true},
+		{"10.0.0.1", "10.0.0.2:80", false},
+		{"10.0.0.1:80", "[::ffff:10.0.0.1]:80", true},
+		{"::1", "[::1]:80", true},
+		{"[::1]", "[::1]:80", true},
+		{"[::1]:80", "[::1]:80", true},
+		{"[::1]:80", "[::1]:81", false},
+
+		// CIDR blocks
+		{"10.0.0.0/8", "10.1.2.3:80", true},
+		{"10.0.0.0/8", "11.1.2.3:80", false},
+		{"10.1.2.3/8", "10.200.0.1:80", true},
+		{"10.0.0.0/8:443", "10.1.2.3:80", false},
+		{"10.0.0.0/8", "[::ffff:10.1.2.3]:80", true},
+		{"fd00::/8", "[fd12::1]:80", true},
+		{"[fd00::/8]:443", "[fd12::1]:443", true},
+		{"[fd00::/8]:443", "[fd12::1]:80", false},
+		{"10.0.0.0/8", "ten.example:80", false},
+
+		// Paths
+		{"/var/run/app.sock", "/var/run/app.sock", true},
+		{"/var/run/*.sock", "/var/run/db.sock", true},
+		{"/var/run/*.sock", "/var/run/sub/db.sock", false},
+		{"@abstract", "@abstract", true},
+		{"/var/run/*.sock", "localhost:80", false},
+	}
+
+	for _, test := range tests {
+		rule, err := ParseAddressRule(test.rule)
+		if err != nil {
+			t.Fatalf("parse rule %q: %v", test.rule, err)
+		}
+
+		if match := rule.Match(test.address); match != test.match {
+			t.Errorf("rule %q, address %q: expected match %t, got %t", test.rule, test.address, test.match, match)
+		}
+	}
+}
+
+func TestPolicyDenyPrecedence(t *testing.T) {
+	p := newPolicy(nil, []string{"tcp"}, false, []string{"*.example.com", "10.0.0.0/8"},
+		[]string{"admin.example.com", "10.0.0.1:22"}, false)
+
+	tests := []struct {
+		network string
+		address string
+		allowed bool
+	}{
+		{"tcp", "api.example.com:443", true},
+		{"tcp", "admin.example.com:443", false},
+		{"tcp", "ADMIN.example.com.:443", false},
+		{"tcp", "10.0.0.1:80", true},
+		{"tcp", "10.0.0.1:22", false},
+		{"tcp", "example.org:443", false},
+		{"udp", "api.example.com:443", false},
+	}
+
+	for _, test := range tests {
+		err := p.check(context.Background(), test.network, test.address)
+		if test.allowed && err != nil {
+			t.Errorf("%s %s: expected to be allowed, got: %v", test.network, test.address, err)
+		}
+		if !test.allowed && !errors.Is(err, internal.ErrPermissionDenied) {
+			t.Errorf("%s %s: expected permission denied, got: %v", test.network, test.address, err)
+		}
+	}
+}
+
+func TestPolicyInvalidRule(t *testing.T) {
+	p := newPolicy(nil, nil, true, nil, []string{"[::1"}, true)
+
+	if err := p.check(context.Background(), "tcp", "example.com:443"); err == nil {
+		t.Fatal("expected invalid rule to deny everything")
+	}
+}
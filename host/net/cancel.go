@@ -0,0 +1,157 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is a deadline in the past, used to interrupt pending IO.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadlines tracks deadlines set by the guest, so pending IO can be interrupted by expiring deadlines and guest
+// deadlines can be restored afterwards.
+//
+// Note: Interrupting IO interrupts all pending IO of the same direction, like concurrent reads of the connection.
+type deadlines struct {
+	setter deadlineSetter
+	read   time.Time
+	write  time.Time
+	lock   sync.Mutex
+}
+
+func (d *deadlines) SetDeadline(t time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.read, d.write = t, t
+	return d.setter.SetDeadline(t)
+}
+
+func (d *deadlines) SetReadDeadline(t time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.read = t
+	return d.setter.SetReadDeadline(t)
+}
+
+func (d *deadlines) SetWriteDeadline(t time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.write = t
+	return d.setter.SetWriteDeadline(t)
+}
+
+// interruptRead interrupts pending reads.
+func (d *deadlines) interruptRead() {
+	_ = d.setter.SetReadDeadline(aLongTimeAgo)
+}
+
+// interruptWrite interrupts pending writes.
+func (d *deadlines) interruptWrite() {
+	_ = d.setter.SetWriteDeadline(aLongTimeAgo)
+}
+
+// restoreRead restores guest read deadline after interrupt.
+func (d *deadlines) restoreRead() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_ = d.setter.SetReadDeadline(d.read)
+}
+
+// restoreWrite restores guest write deadline after interrupt.
+func (d *deadlines) restoreWrite() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_ = d.setter.SetWriteDeadline(d.write)
+}
+
+// cancelConn is a connection which IO can be interrupted.
+type cancelConn struct {
+	net.Conn
+	*deadlines
+}
+
+// newCancelConn wraps the connection to allow interrupting its IO.
+func newCancelConn(conn net.Conn) *cancelConn {
+	return &cancelConn{
+		Conn:      conn,
+		deadlines: &deadlines{setter: conn},
+	}
+}
+
+func (c *cancelConn) SetDeadline(t time.Time) error {
+	return c.deadlines.SetDeadline(t)
+}
+
+func (c *cancelConn) SetReadDeadline(t time.Time) error {
+	return c.deadlines.SetReadDeadline(t)
+}
+
+func (c *cancelConn) SetWriteDeadline(t time.Time) error {
+	return c.deadlines.SetWriteDeadline(t)
+}
+
+func (c *cancelConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// cancelPacketConn is a packet connection which IO can be interrupted.
+type cancelPacketConn struct {
+	net.PacketConn
+	*deadlines
+}
+
+// newCancelPacketConn wraps the packet connection to allow interrupting its IO.
+func newCancelPacketConn(packetConn net.PacketConn) *cancelPacketConn {
+	return &cancelPacketConn{
+		PacketConn: packetConn,
+		deadlines:  &deadlines{setter: packetConn},
+	}
+}
+
+func (c *cancelPacketConn) SetDeadline(t time.Time) error {
+	return c.deadlines.SetDeadline(t)
+}
+
+func (c *cancelPacketConn) SetReadDeadline(t time.Time) error {
+	return c.deadlines.SetReadDeadline(t)
+}
+
+func (c *cancelPacketConn) SetWriteDeadline(t time.Time) error {
+	return c.deadlines.SetWriteDeadline(t)
+}
+
+// interrupter is implemented by connections which IO can be interrupted.
+type interrupter interface {
+	interruptRead()
+	interruptWrite()
+	restoreRead()
+	restoreWrite()
+}
+
+// readInterrupt returns functions to interrupt pending reads and restore deadline after, nil if not supported.
+func readInterrupt(conn any) (cancel, restore func()) {
+	i, ok := conn.(interrupter)
+	if !ok {
+		return nil, nil
+	}
+	return i.interruptRead, i.restoreRead
+}
+
+// writeInterrupt returns functions to interrupt pending writes and restore deadline after, nil if not supported.
+func writeInterrupt(conn any) (cancel, restore func()) {
+	i, ok := conn.(interrupter)
+	if !ok {
+		return nil, nil
+	}
+	return i.interruptWrite, i.restoreWrite
+}
+
+// acceptInterrupt returns functions to interrupt pending accept and remove deadline after, nil if not supported.
+func acceptInterrupt(listener net.Listener) (cancel, restore func()) {
+	l, ok := listener.(interface{ SetDeadline(t time.Time) error })
+	if !ok {
+		return nil, nil
+	}
+	return func() { _ = l.SetDeadline(aLongTimeAgo) }, func() { _ = l.SetDeadline(time.Time{}) }
+}
@@ -0,0 +1,406 @@
+package net
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// Cassette operations.
+const (
+	cassetteOpDial  = "dial"
+	cassetteOpRead  = "read"
+	cassetteOpWrite = "write"
+	cassetteOpClose = "close"
+)
+
+// ErrCassetteMiss is returned in replay mode if cassette has no recorded dial matching the dialed address.
+var ErrCassetteMiss = errors.New("no recorded dial in cassette")
+
+// cassetteEvent is a single recorded event, cassette is encoded as JSON lines of events.
+type cassetteEvent struct {
+	// Conn is the sequence number of connection the event belongs to
+	Conn int64 `json:"conn"`
+	// Op is the operation of the event
+	Op string `json:"op"`
+	// Time is the time passed since dial
+	Time time.Duration `json:"time"`
+
+	// Dial only fields
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	TLS     bool   `json:"tls,omitempty"`
+	Local   string `json:"local,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+
+	// Data is read or written data
+	Data []byte `json:"data,omitempty"`
+	// Redacted is set for writes recorded without data
+	Redacted bool `json:"redacted,omitempty"`
+
+	// Code and Error describe the error of the operation, code is the same as reported to the guest
+	Code  int32  `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Cassette records stream connections dialed by [Dialer] or replays them without touching the network.
+//
+// Recorded are dials (including failed ones), reads, writes and closes with timing, TLS connections are recorded after
+// TLS handshake, so plaintext is stored and replay doesn't depend on TLS randomness. In replay mode policies and quotas
+// are applied as usual, but instead of dialing, recorded connection with the same network, address and TLS usage is
+// returned (in the order of recording), its reads return recorded data and errors, writes are discarded. Recorded timing
+// is informational only, replayed reads return data immediately without waiting. Packet connections and listeners are
+// not recorded.
+//
+// Writes to destinations that have [Credentials] are recorded without data, so credentials injected by the host (HTTP
+// headers, basic authentication, etc.) never reach the cassette, replay doesn't need them as writes are discarded.
+// Reads are always recorded as is, so cassettes must not be shared if responses contain secrets.
+type Cassette struct {
+	replay bool
+
+	// Record mode
+	encoder *json.Encoder
+	closer  io.Closer
+	lock    sync.Mutex
+	conns   int64
+
+	// Replay mode
+	dials  []*cassetteEvent
+	reads  map[int64][]*cassetteEvent
+	used   map[int64]bool
+	loaded error
+}
+
+// NewCassetteRecorder creates a cassette that records connections into the writer as JSON lines, the writer is not
+// closed by the cassette.
+func NewCassetteRecorder(w io.Writer) *Cassette {
+	return &Cassette{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// NewCassetteReplayer creates a cassette that replays connections recorded by [NewCassetteRecorder] from the reader.
+func NewCassetteReplayer(r io.Reader) (*Cassette, error) {
+	c := &Cassette{
+		replay: true,
+		reads:  make(map[int64][]*cassetteEvent),
+		used:   make(map[int64]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		event := &cassetteEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, fmt.Errorf("invalid cassette event: %w", err)
+		}
+
+		switch event.Op {
+		case cassetteOpDial:
+			c.dials = append(c.dials, event)
+		case cassetteOpRead:
+			c.reads[event.Conn] = append(c.reads[event.Conn], event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+
+	return c, nil
+}
+
+// OpenCassette opens cassette file in record or replay mode, record mode truncates the file and keeps it open until
+// the cassette is closed, replay mode reads the whole file at once. Errors are reported on dial, so the network is never
+// reached because of missing cassette in replay mode.
+func OpenCassette(filename string, replay bool) *Cassette {
+	if !replay {
+		file, err := os.Create(filename)
+		if err != nil {
+			return &Cassette{replay: true, loaded: err}
+		}
+
+		c := NewCassetteRecorder(file)
+		c.closer = file
+		return c
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return &Cassette{replay: true, loaded: err}
+	}
+	defer func() { _ = file.Close() }()
+
+	c, err := NewCassetteReplayer(file)
+	if err != nil {
+		return &Cassette{replay: true, loaded: err}
+	}
+	return c
+}
+
+// Close closes the file opened by [OpenCassette], events recorded after close are discarded. It's safe to call multiple
+// times and on cassettes created from writers or readers, in that case it does nothing.
+func (c *Cassette) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closer == nil {
+		return nil
+	}
+
+	err := c.closer.Close()
+	c.closer = nil
+	c.encoder = json.NewEncoder(io.Discard)
+	return err
+}
+
+// replaying reports whether the cassette is in replay mode.
+func (c *Cassette) replaying() bool {
+	return c != nil && c.replay
+}
+
+// write records the event.
+func (c *Cassette) write(event *cassetteEvent) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_ = c.encoder.Encode(event)
+}
+
+// record records the dial and returns connection that records its IO, writes are recorded without data if redactWrites
+// is set. No-op if cassette is nil.
+func (c *Cassette) record(network, address string, tls bool, redactWrites bool, conn net.Conn, err error,
+) (net.Conn, error) {
+	if c == nil {
+		return conn, err
+	}
+
+	c.lock.Lock()
+	c.conns++
+	id := c.conns
+	c.lock.Unlock()
+
+	event := &cassetteEvent{
+		Conn:    id,
+		Op:      cassetteOpDial,
+		Network: network,
+		Address: address,
+		TLS:     tls,
+	}
+	if err != nil {
+		event.Code, event.Error = internal.ErrorCode(err), err.Error()
+		c.write(event)
+		return nil, err
+	}
+	event.Local, event.Remote = conn.LocalAddr().String(), conn.RemoteAddr().String()
+	c.write(event)
+
+	return &recordConn{
+		Conn:         conn,
+		cassette:     c,
+		id:           id,
+		start:        time.Now(),
+		redactWrites: redactWrites,
+	}, nil
+}
+
+// play returns replayed connection for the dial.
+func (c *Cassette) play(network, address string, tls bool) (net.Conn, error) {
+	if c.loaded != nil {
+		return nil, fmt.Errorf("cassette: %w", c.loaded)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, dial := range c.dials {
+		if c.used[dial.Conn] || dial.Network != network || dial.Address != address || dial.TLS != tls {
+			continue
+		}
+		c.used[dial.Conn] = true
+
+		if dial.Error != "" {
+			return nil, cassetteError(dial.Code, dial.Error)
+		}
+
+		return &replayConn{
+			reads:  c.reads[dial.Conn],
+			local:  &genericAddr{network: network, address: dial.Local},
+			remote: &genericAddr{network: network, address: dial.Remote},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, network, address)
+}
+
+// cassetteError returns replayed error for the error code.
+func cassetteError(code int32, message string) error {
+	switch code {
+	case internal.ErrCodeEOF:
+		return io.EOF
+	case internal.ErrCodeDeadlineExceeded:
+		return os.ErrDeadlineExceeded
+	case internal.ErrCodeConnectionRefused:
+		return syscall.ECONNREFUSED
+	case internal.ErrCodeConnectionReset:
+		return syscall.ECONNRESET
+	case internal.ErrCodeClosed:
+		return net.ErrClosed
+	case internal.ErrCodePermissionDenied:
+		return fmt.Errorf("%w: %s", internal.ErrPermissionDenied, message)
+	default:
+		return errors.New(message)
+	}
+}
+
+// recordConn is a connection that records its IO into the cassette.
+type recordConn struct {
+	net.Conn
+	cassette     *Cassette
+	id           int64
+	start        time.Time
+	redactWrites bool
+}
+
+func (c *recordConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.event(cassetteOpRead, b[:n], err)
+	return n, err
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	data := b[:n]
+	if c.redactWrites {
+		data = nil
+	}
+	c.event(cassetteOpWrite, data, err)
+
+	return n, err
+}
+
+func (c *recordConn) Close() error {
+	err := c.Conn.Close()
+	c.event(cassetteOpClose, nil, err)
+	return err
+}
+
+func (c *recordConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// event records IO event of the connection.
+func (c *recordConn) event(op string, data []byte, err error) {
+	event := &cassetteEvent{
+		Conn: c.id,
+		Op:   op,
+		Time: time.Since(c.start),
+		Data: data,
+	}
+	if op == cassetteOpWrite && c.redactWrites {
+		event.Redacted = true
+	}
+	if err != nil {
+		event.Code, event.Error = internal.ErrorCode(err), err.Error()
+	}
+	c.cassette.write(event)
+}
+
+// replayConn is a connection that returns recorded reads, writes are discarded.
+type replayConn struct {
+	reads  []*cassetteEvent
+	data   []byte
+	local  net.Addr
+	remote net.Addr
+	closed bool
+	lock   sync.Mutex
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	for len(c.data) == 0 {
+		if len(c.reads) == 0 {
+			return 0, io.EOF
+		}
+
+		event := c.reads[0]
+		c.reads = c.reads[1:]
+		c.data = event.Data
+
+		if event.Error != "" {
+			if len(c.data) > 0 {
+				// Return data first, error is returned by the next read
+				c.reads = append([]*cassetteEvent{{Code: event.Code, Error: event.Error}}, c.reads...)
+				break
+			}
+			return 0, cassetteError(event.Code, event.Error)
+		}
+	}
+
+	n := copy(b, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	return len(b), nil
+}
+
+func (c *replayConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *replayConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
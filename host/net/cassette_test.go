@@ -0,0 +1,195 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// pingPongDial returns dial function that serves "pong" for "ping" and refuses connections to "refused:80".
+func pingPongDial(t *testing.T) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(_ context.Context, _, address string) (net.Conn, error) {
+		if address == "refused:80" {
+			return nil, syscall.ECONNREFUSED
+		}
+
+		client, server := net.Pipe()
+		go func() {
+			defer func() { _ = server.Close() }()
+
+			request := make([]byte, 4)
+			if _, err := io.ReadFull(server, request); err != nil {
+				t.Errorf("server read: %v", err)
+				return
+			}
+			if string(request) != "ping" {
+				t.Errorf("unexpected request: %q", request)
+				return
+			}
+			_, _ = server.Write([]byte("pong"))
+		}()
+		return client, nil
+	}
+}
+
+// pingPong writes "ping" to the connection and returns everything read from it.
+func pingPong(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(response)
+}
+
+// cassetteDialer returns dialer that allows everything and uses the cassette.
+func cassetteDialer(cassette *Cassette, dial func(ctx context.Context, network, address string) (net.Conn, error),
+) *Dialer {
+	return NewDialer(DialConfig{
+		NetworksAllowAll:         true,
+		NetworkAddressesAllowAll: true,
+		Cassette:                 cassette,
+		DialContext:              dial,
+	})
+}
+
+// noDial fails the test if the network is dialed.
+func noDial(t *testing.T) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(_ context.Context, network, address string) (net.Conn, error) {
+		t.Errorf("network dialed in replay mode: %s %s", network, address)
+		return nil, errors.New("unexpected dial")
+	}
+}
+
+// record records a successful and a refused dial into the cassette.
+func record(t *testing.T, cassette *Cassette) {
+	t.Helper()
+	ctx := context.Background()
+	dialer := cassetteDialer(cassette, pingPongDial(t))
+
+	conn, err := dialer.DialContext(ctx, "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if response := pingPong(t, conn); response != "pong" {
+		t.Fatalf("unexpected response: %q", response)
+	}
+
+	if _, err = dialer.DialContext(ctx, "tcp", "refused:80"); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("expected connection refused, got: %v", err)
+	}
+}
+
+// replay checks that the cassette replays connections recorded by record.
+func replay(t *testing.T, cassette *Cassette) {
+	t.Helper()
+	ctx := context.Background()
+	dialer := cassetteDialer(cassette, noDial(t))
+
+	conn, err := dialer.DialContext(ctx, "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("replay dial: %v", err)
+	}
+	if response := pingPong(t, conn); response != "pong" {
+		t.Fatalf("unexpected replayed response: %q", response)
+	}
+
+	if _, err = dialer.DialContext(ctx, "tcp", "refused:80"); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("expected replayed connection refused, got: %v", err)
+	}
+
+	if _, err = dialer.DialContext(ctx, "tcp", "example.com:80"); !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected cassette miss for second dial, got: %v", err)
+	}
+}
+
+func TestCassetteRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	record(t, NewCassetteRecorder(&buf))
+
+	cassette, err := NewCassetteReplayer(&buf)
+	if err != nil {
+		t.Fatalf("load cassette: %v", err)
+	}
+	replay(t, cassette)
+}
+
+func TestOpenCassette(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	recorder := OpenCassette(filename, false)
+	record(t, recorder)
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("close recorder: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("second close of recorder: %v", err)
+	}
+
+	replayer := OpenCassette(filename, true)
+	replay(t, replayer)
+	if err := replayer.Close(); err != nil {
+		t.Fatalf("close replayer: %v", err)
+	}
+}
+
+func TestOpenCassetteMissingFile(t *testing.T) {
+	cassette := OpenCassette(filepath.Join(t.TempDir(), "missing.jsonl"), true)
+
+	dialer := cassetteDialer(cassette, noDial(t))
+	if _, err := dialer.DialContext(context.Background(), "tcp", "example.com:80"); err == nil {
+		t.Fatal("expected error for missing cassette file")
+	}
+}
+
+func TestCassetteRedactsCredentialWrites(t *testing.T) {
+	var buf bytes.Buffer
+	dialer := NewDialer(DialConfig{
+		NetworksAllowAll:         true,
+		NetworkAddressesAllowAll: true,
+		Cassette:                 NewCassetteRecorder(&buf),
+		DialContext:              pingPongDial(t),
+		Credentials: NewCredentials([]Credential{{
+			Destinations: []string{"secret.example.com"},
+			BearerToken:  "token",
+		}}),
+	})
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "secret.example.com:80")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if response := pingPong(t, conn); response != "pong" {
+		t.Fatalf("unexpected response: %q", response)
+	}
+
+	// Written data is base64 encoded in the cassette
+	if recorded := buf.String(); strings.Contains(recorded, `"cGluZw=="`) || !strings.Contains(recorded, `"cG9uZw=="`) {
+		t.Fatalf("unexpected recorded data: %s", recorded)
+	}
+
+	cassette, err := NewCassetteReplayer(&buf)
+	if err != nil {
+		t.Fatalf("load cassette: %v", err)
+	}
+
+	conn, err = cassetteDialer(cassette, noDial(t)).DialContext(context.Background(), "tcp", "secret.example.com:80")
+	if err != nil {
+		t.Fatalf("replay dial: %v", err)
+	}
+	if response := pingPong(t, conn); response != "pong" {
+		t.Fatalf("unexpected replayed response: %q", response)
+	}
+}
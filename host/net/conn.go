@@ -2,7 +2,6 @@ package net
 
 import (
 	"context"
-	"math/rand/v2"
 
 	extism "github.com/extism/go-sdk"
 
@@ -13,30 +12,32 @@ import (
 func ConnRead() extism.HostFunction {
 	return internal.NewHostFunction("net.conn.read",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
 			connectionID := extism.DecodeI32(stack[0])
 
-			length, err := p.Length(stack[1])
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			length, err := internal.ReadLength(p, stack[1])
 			if err != nil {
-				panic(err)
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
 			}
 
-			buffer, ok := p.Memory().Read(uint32(stack[1]), uint32(length))
+			op := internal.NewReadOperation(stack[1], length)
+			handle, ok := resources.IOHandles.Add(op)
 			if !ok {
-				panic("failed to read buffer")
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
 			}
 
-			handle := rand.Int32()
-			internal.IOHandles.Set(handle, 0)
-
-			conn := internal.Connections.Get(connectionID)
-			go func() {
-				var n int
-				n, err = conn.Read(buffer)
-				if err != nil {
-					panic(err)
-				}
-				internal.IOHandles.Set(handle, int32(n))
-			}()
+			cancel, restore := readInterrupt(conn)
+			op.Go(ctx, func() (int, error) {
+				return conn.Read(op.Buffer())
+			}, cancel, restore)
 
 			stack[0] = extism.EncodeI32(handle)
 		},
@@ -49,30 +50,32 @@ func ConnRead() extism.HostFunction {
 func ConnWrite() extism.HostFunction {
 	return internal.NewHostFunction("net.conn.write",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
 			connectionID := extism.DecodeI32(stack[0])
 
-			length, err := p.Length(stack[1])
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			buffer, err := internal.CopyBytes(p, stack[1])
 			if err != nil {
-				panic(err)
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
 			}
 
-			buffer, ok := p.Memory().Read(uint32(stack[1]), uint32(length))
+			op := internal.NewIOOperation()
+			handle, ok := resources.IOHandles.Add(op)
 			if !ok {
-				panic("failed to read buffer")
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
 			}
 
-			handle := rand.Int32()
-			internal.IOHandles.Set(handle, 0)
-
-			conn := internal.Connections.Get(connectionID)
-			go func() {
-				var n int
-				n, err = conn.Write(buffer)
-				if err != nil {
-					panic(err)
-				}
-				internal.IOHandles.Set(handle, int32(n))
-			}()
+			cancel, restore := writeInterrupt(conn)
+			op.Go(ctx, func() (int, error) {
+				return conn.Write(buffer)
+			}, cancel, restore)
 
 			stack[0] = extism.EncodeI32(handle)
 		},
@@ -85,13 +88,18 @@ func ConnWrite() extism.HostFunction {
 func ConnClose() extism.HostFunction {
 	return internal.NewHostFunction("net.conn.close",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
 			connectionID := extism.DecodeI32(stack[0])
 
-			conn := internal.Connections.Get(connectionID)
+			conn, ok := resources.Connections.Remove(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
 
 			var result int32
 			if err := conn.Close(); err != nil {
-				result = -1
+				result = resources.Fail(err)
 			}
 
 			stack[0] = extism.EncodeI32(result)
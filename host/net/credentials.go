@@ -0,0 +1,136 @@
+package net
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+)
+
+// Credential configures credentials that the host adds to egress traffic for matching destinations. Credentials are
+// never exposed to the guest, so a compromised plugin can only use them with the configured destinations.
+type Credential struct {
+	// Destinations configures addresses the credential is used for, see [AddressRule] for syntax. Rules are matched
+	// against addresses dialed by the guest, before rewrites.
+	Destinations []string `json:"destinations" yaml:"destinations" toml:"destinations"`
+
+	// Headers configures headers set on HTTP requests executed on the host, replacing headers sent by the guest.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+	// Username and Password configure basic authentication of HTTP requests executed on the host.
+	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty"`
+	// BearerToken configures bearer token authentication of HTTP requests executed on the host.
+	BearerToken string `json:"bearerToken,omitempty" yaml:"bearerToken,omitempty" toml:"bearerToken,omitempty"`
+
+	// ClientCertificates configures client certificates for mutual TLS of connections with TLS performed by the host.
+	ClientCertificates []tls.Certificate `json:"-" yaml:"-" toml:"-"`
+	// ClientCertFile and ClientKeyFile configure client certificate for mutual TLS from PEM files.
+	ClientCertFile string `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty" toml:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty" toml:"clientKeyFile,omitempty"`
+}
+
+// credentialRule is a compiled credential.
+type credentialRule struct {
+	destinations []AddressRule
+	credential   Credential
+}
+
+// Credentials is a compiled set of credentials, the first credential matching the destination is used.
+type Credentials struct {
+	rules []credentialRule
+
+	// err is set if any of credentials is invalid, in that case all HTTP requests and TLS connections made by the host
+	// fail
+	err error
+}
+
+// NewCredentials compiles credentials. Invalid configuration is reported when credentials are used, so requests are
+// never sent without credentials because of misconfiguration.
+func NewCredentials(credentials []Credential) *Credentials {
+	c := &Credentials{
+		rules: make([]credentialRule, 0, len(credentials)),
+	}
+
+	for _, credential := range credentials {
+		destinations, err := parseAddressRules(credential.Destinations)
+		if err != nil {
+			c.err = fmt.Errorf("invalid credential: %w", err)
+			return c
+		}
+
+		if credential.ClientCertFile != "" || credential.ClientKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(credential.ClientCertFile, credential.ClientKeyFile)
+			if err != nil {
+				c.err = fmt.Errorf("invalid credential: %w", err)
+				return c
+			}
+			credential.ClientCertificates = append(slices.Clone(credential.ClientCertificates), cert)
+		}
+
+		c.rules = append(c.rules, credentialRule{
+			destinations: destinations,
+			credential:   credential,
+		})
+	}
+
+	return c
+}
+
+// match returns the credential for the address, returns false if there is no matching credential.
+func (c *Credentials) match(address string) (Credential, bool, error) {
+	if c == nil {
+		return Credential{}, false, nil
+	}
+
+	if c.err != nil {
+		return Credential{}, false, c.err
+	}
+
+	for _, rule := range c.rules {
+		if slices.ContainsFunc(rule.destinations, func(r AddressRule) bool { return r.Match(address) }) {
+			return rule.credential, true, nil
+		}
+	}
+
+	return Credential{}, false, nil
+}
+
+// ApplyHTTP adds headers and authentication of the credential matching the request host.
+func (c *Credentials) ApplyHTTP(request *http.Request) error {
+	address := request.URL.Host
+	if request.URL.Port() == "" {
+		port := "80"
+		if request.URL.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(request.URL.Hostname(), port)
+	}
+
+	credential, ok, err := c.match(address)
+	if err != nil || !ok {
+		return err
+	}
+
+	for name, value := range credential.Headers {
+		request.Header.Set(name, value)
+	}
+
+	switch {
+	case credential.BearerToken != "":
+		request.Header.Set("Authorization", "Bearer "+credential.BearerToken)
+	case credential.Username != "" || credential.Password != "":
+		request.SetBasicAuth(credential.Username, credential.Password)
+	}
+
+	return nil
+}
+
+// clientCertificates returns client certificates for mutual TLS with the address, returns nil if there are none.
+func (c *Credentials) clientCertificates(address string) ([]tls.Certificate, error) {
+	credential, ok, err := c.match(address)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return credential.ClientCertificates, nil
+}
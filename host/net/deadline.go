@@ -0,0 +1,101 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// Deadline modes.
+const (
+	deadlineModeReadWrite = 0
+	deadlineModeRead      = 1
+	deadlineModeWrite     = 2
+)
+
+// deadlineSetter is implemented by connections that support deadlines.
+type deadlineSetter interface {
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// ConnSetDeadline sets the read and/or write deadline of a connection.
+// Deadline is passed as a timeout in nanoseconds relative to now, so guest and host clocks don't need to match, zero
+// means no deadline and negative value means already expired deadline.
+func ConnSetDeadline() extism.HostFunction {
+	return internal.NewHostFunction("net.conn.setDeadline",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			connectionID := extism.DecodeI32(stack[0])
+
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := setDeadline(conn, extism.DecodeI32(stack[1]), int64(stack[2])); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{
+			extism.ValueTypeI32 /* connectionID */, extism.ValueTypeI32 /* mode */, extism.ValueTypeI64, /* timeout */
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// PacketConnSetDeadline sets the read and/or write deadline of a packet connection.
+// Deadline is passed the same way as for [ConnSetDeadline].
+func PacketConnSetDeadline() extism.HostFunction {
+	return internal.NewHostFunction("net.packetConn.setDeadline",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			packetConnID := extism.DecodeI32(stack[0])
+
+			packetConn, ok := resources.PacketConnections.Get(packetConnID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := setDeadline(packetConn, extism.DecodeI32(stack[1]), int64(stack[2])); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{
+			extism.ValueTypeI32 /* packetConnectionID */, extism.ValueTypeI32 /* mode */, extism.ValueTypeI64, /* timeout */
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// setDeadline sets deadline based on mode and timeout.
+func setDeadline(conn deadlineSetter, mode int32, timeout int64) error {
+	var deadline time.Time
+	if timeout != 0 {
+		deadline = time.Now().Add(time.Duration(timeout))
+	}
+
+	switch mode {
+	case deadlineModeReadWrite:
+		return conn.SetDeadline(deadline)
+	case deadlineModeRead:
+		return conn.SetReadDeadline(deadline)
+	case deadlineModeWrite:
+		return conn.SetWriteDeadline(deadline)
+	default:
+		return fmt.Errorf("%w: unknown deadline mode: %d", internal.ErrInvalidArgument, mode)
+	}
+}
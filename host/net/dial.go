@@ -2,10 +2,11 @@ package net
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand/v2"
 	"net"
-	"slices"
+	"net/http"
+	"time"
 
 	extism "github.com/extism/go-sdk"
 
@@ -23,60 +24,152 @@ type DialConfig struct {
 	// NetworksAllowAll allows all network protocols. Defaults to false.
 	NetworksAllowAll bool
 
-	// NetworkAddressesAllowed configures the allowed network addresses. Defaults to none.
+	// NetworkAddressesAllowed configures the allowed network addresses, see [AddressRule] for syntax.
+	// Defaults to none.
 	NetworkAddressesAllowed []string
+	// NetworkAddressesDenied configures the denied network addresses, see [AddressRule] for syntax. Takes priority
+	// over allowed addresses. Defaults to none.
+	NetworkAddressesDenied []string
 	// NetworkAddressesAllowAll allows all network addresses. Defaults to false.
 	NetworkAddressesAllowAll bool
+
+	// NetworkIPsAllowed configures the allowed IPs that addresses are resolved to, see [IPRule] for syntax. Checked
+	// after host name resolution, so DNS can't be used to bypass address rules. Defaults to all.
+	NetworkIPsAllowed []string
+	// NetworkIPsDenied configures the denied IPs that addresses are resolved to, see [IPRule] for syntax. Takes priority
+	// over allowed IPs. Defaults to none.
+	NetworkIPsDenied []string
+
+	// Hosts configures static host names to IPs mapping, takes priority over DNS. Defaults to none.
+	Hosts map[string][]string
+	// HostsFile configures static hosts from a file in hosts file format merged with Hosts, see [ReadHostsFile]. If the
+	// file can't be read, all lookups and dials fail. Defaults to none.
+	HostsFile string
+	// HostsOnly disables DNS, only static hosts and IPs are resolved. Defaults to false.
+	HostsOnly bool
+
+	// UnixSockets maps guest Unix socket paths to host socket paths, guest paths ending with "/" map all sockets under
+	// them. If set, only mapped paths can be dialed on Unix networks, address rules are matched against guest paths.
+	// Defaults to nil (guest paths are host paths).
+	UnixSockets map[string]string
+
+	// Proxy configures upstream proxy for TCP connections, see [NewProxy]. Defaults to no proxy.
+	Proxy *Proxy
+
+	// Cassette records dialed connections or replays them without touching the network, see [Cassette]. Defaults to
+	// nil (no recording).
+	Cassette *Cassette
+
+	// DialContext replaces dialing of the network, for example to serve connections from in-process services. Policies,
+	// quotas and handlers are applied as usual, but addresses are passed as is, without resolution and IP policy.
+	// Defaults to nil (network is dialed).
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Handlers configures HTTP handlers that serve connections to the addresses (as dialed by the guest, for example
+	// "api.internal:80") over in-memory pipes, takes priority over DialContext. TLS dials to handler addresses return
+	// plaintext connections, as TLS is terminated in-process. Defaults to none.
+	Handlers map[string]http.Handler
+
+	// Namespace configures virtual network, connections to addresses of its listeners are routed in memory, see
+	// [Namespace]. Connections to other addresses are refused, only handlers take priority. Namespace addresses are not
+	// resolved, so IP policy is not applied to them. Defaults to nil.
+	Namespace *Namespace
+
+	// Rewrites maps guest dial addresses to targets that are dialed instead, for example {"localhost:5432":
+	// "db.prod.internal:5432", "api": "unix:/run/api.sock"}. Guest address without port matches the host with any port,
+	// target can be prefixed with a network to change it and target without port keeps the guest port. Address policy
+	// is checked against guest addresses, IP policy is checked against resolved targets. Defaults to none.
+	Rewrites map[string]string
+
+	// Credentials configures credentials added by the host for matching destinations, see [NewCredentials]. Client
+	// certificates are used for TLS performed by the host, HTTP credentials are applied by HTTP host functions. Defaults
+	// to none.
+	Credentials *Credentials
+
+	// Quota configures network usage limits shared with other host functions, see [NewQuota]. Defaults to no limits.
+	Quota *Quota
+}
+
+// policy returns compiled dial policy.
+func (cfg DialConfig) policy() *policy {
+	return newPolicy(cfg.NetworkFilter, cfg.NetworksAllowed, cfg.NetworksAllowAll,
+		cfg.NetworkAddressesAllowed, cfg.NetworkAddressesDenied, cfg.NetworkAddressesAllowAll)
 }
 
-// Dial creates a host function that calls [net.Dial].
+// Validate returns an error if the configuration is invalid: address or IP rules can't be parsed, static hosts can't be
+// loaded, proxy, credentials or cassette are invalid. Dialer created with invalid configuration fails every dial.
+func (cfg DialConfig) Validate() error {
+	errs := []error{
+		cfg.policy().err,
+		newIPPolicy(cfg.NetworkIPsAllowed, cfg.NetworkIPsDenied).err,
+		newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly).err,
+	}
+	if cfg.Proxy != nil {
+		errs = append(errs, cfg.Proxy.err)
+	}
+	if cfg.Credentials != nil {
+		errs = append(errs, cfg.Credentials.err)
+	}
+	if cfg.Cassette != nil && cfg.Cassette.loaded != nil {
+		errs = append(errs, fmt.Errorf("cassette: %w", cfg.Cassette.loaded))
+	}
+	return errors.Join(errs...)
+}
+
+// Dial creates a host function that calls [Dialer.DialContext].
+// Timeout is passed in nanoseconds, zero means no timeout and negative value means already expired timeout, dial is
+// also canceled if the plugin call's context is canceled.
 func Dial(cfg DialConfig) extism.HostFunction {
+	dialer := NewDialer(cfg)
 	return internal.NewHostFunction("net.dial",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
-			network, err := p.ReadString(stack[0])
-			if err != nil {
-				panic(err)
-			}
+			resources := internal.PluginResources(ctx)
 
-			if cfg.NetworkFilter == nil && !cfg.NetworksAllowAll &&
-				!slices.Contains(cfg.NetworksAllowed, network) {
-				panic(fmt.Errorf("network not allowed: %s", network))
-			}
-
-			addr, err := p.ReadString(stack[1])
+			network, err := internal.ReadString(p, stack[0])
 			if err != nil {
-				panic(err)
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
 			}
 
-			if cfg.NetworkFilter == nil && !cfg.NetworkAddressesAllowAll &&
-				!slices.Contains(cfg.NetworkAddressesAllowed, addr) {
-				panic(fmt.Errorf("address not allowed: %s", addr))
+			addr, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
 			}
 
-			if cfg.NetworkFilter != nil {
-				var allowed bool
-				allowed, err = cfg.NetworkFilter(ctx, network, addr)
-				if err != nil {
-					panic(fmt.Errorf("network filter: %w", err))
-				}
+			ctx, cancel := dialContext(ctx, int64(stack[2]))
+			defer cancel()
 
-				if !allowed {
-					panic(fmt.Errorf("not allowed network and/or address"))
-				}
-			}
-
-			dialer := &net.Dialer{}
 			conn, err := dialer.DialContext(ctx, network, addr)
 			if err != nil {
-				panic(err)
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
 			}
 
-			connID := rand.Int32N(10000)
-			internal.Connections.Set(connID, conn)
+			connID, ok := resources.Connections.Add(newCancelConn(conn))
+			if !ok {
+				_ = conn.Close()
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
 
 			stack[0] = extism.EncodeI32(connID)
 		},
-		[]extism.ValueType{extism.ValueTypePTR /* network */, extism.ValueTypePTR /* address */},
+		[]extism.ValueType{
+			extism.ValueTypePTR /* network */, extism.ValueTypePTR /* address */, extism.ValueTypeI64, /* timeout */
+		},
 		[]extism.ValueType{extism.ValueTypeI32 /* connectionID | errorCode */},
 	)
 }
+
+// dialContext returns context of dial with timeout in nanoseconds, zero means no timeout and negative value means
+// already expired timeout.
+func dialContext(ctx context.Context, timeout int64) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	if timeout < 0 {
+		return context.WithDeadline(ctx, aLongTimeAgo)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout))
+}
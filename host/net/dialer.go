@@ -0,0 +1,387 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// Dialer dials network addresses according to the [DialConfig].
+//
+// For TCP and UDP networks host names are resolved by the dialer itself (using static hosts first) and every resolved IP
+// is checked against the IP policy, only vetted IPs are dialed, so DNS rebinding can't be used to bypass the policy.
+// TCP connections go through the upstream [Proxy] if configured.
+type Dialer struct {
+	policy   *policy
+	ipPolicy *ipPolicy
+	dialer   *net.Dialer
+	resolver *resolver
+	quota    *Quota
+	unix     unixSockets
+	proxy    *Proxy
+	cassette *Cassette
+	custom   func(ctx context.Context, network, address string) (net.Conn, error)
+	handlers map[string]http.Handler
+	ns       *Namespace
+	rewrites *rewrites
+
+	credentials *Credentials
+}
+
+// NewDialer creates a new dialer.
+func NewDialer(cfg DialConfig) *Dialer {
+	return &Dialer{
+		policy:   cfg.policy(),
+		ipPolicy: newIPPolicy(cfg.NetworkIPsAllowed, cfg.NetworkIPsDenied),
+		dialer:   &net.Dialer{},
+		resolver: newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly),
+		quota:    cfg.Quota,
+		unix:     cfg.UnixSockets,
+		proxy:    cfg.Proxy,
+		cassette: cfg.Cassette,
+		custom:   cfg.DialContext,
+		handlers: cfg.Handlers,
+		ns:       cfg.Namespace,
+		rewrites: newRewrites(cfg.Rewrites),
+
+		credentials: cfg.Credentials,
+	}
+}
+
+// DialContext connects to the address on the named network if allowed, see [net.Dialer.DialContext].
+// Returns [ErrConnectionLimit] if quota has no connections left.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.cassette.replaying() {
+		return d.replay(ctx, network, address, false)
+	}
+
+	conn, err := d.dialContext(ctx, network, address)
+	return d.cassette.record(network, address, false, d.hasCredentials(address), conn, err)
+}
+
+// dialContext connects to the address on the named network if allowed, connection is tracked by the quota.
+func (d *Dialer) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := d.check(ctx, network, address); err != nil {
+		return nil, err
+	}
+
+	quota := d.quota.plugin(ctx)
+	if err := quota.acquire(); err != nil {
+		return nil, err
+	}
+
+	conn, err := d.dial(ctx, network, address)
+	if err != nil {
+		quota.release()
+		return nil, err
+	}
+
+	return quota.trackConn(conn), nil
+}
+
+// hasCredentials reports whether the host may inject credentials into connections to the address, invalid credentials
+// are treated as matching.
+func (d *Dialer) hasCredentials(address string) bool {
+	_, ok, err := d.credentials.match(address)
+	return ok || err != nil
+}
+
+// check checks that the address on the named network is allowed, nothing is allowed if static hosts are invalid.
+func (d *Dialer) check(ctx context.Context, network, address string) error {
+	if d.resolver.err != nil {
+		return d.resolver.err
+	}
+	return d.policy.check(ctx, network, address)
+}
+
+// replay returns connection replayed from the cassette if allowed, connection is tracked by the quota.
+func (d *Dialer) replay(ctx context.Context, network, address string, tls bool) (net.Conn, error) {
+	if err := d.check(ctx, network, address); err != nil {
+		return nil, err
+	}
+
+	quota := d.quota.plugin(ctx)
+	if err := quota.acquire(); err != nil {
+		return nil, err
+	}
+
+	conn, err := d.cassette.play(network, address, tls)
+	if err != nil {
+		quota.release()
+		return nil, err
+	}
+
+	return quota.trackConn(conn), nil
+}
+
+// dial connects to the address on the named network, address is rewritten first if there is a matching rewrite rule.
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	targetNetwork, targetAddress, ok := d.rewrites.rewrite(network, address)
+	if !ok {
+		return d.dialTarget(ctx, network, address, false)
+	}
+
+	conn, err := d.dialTarget(ctx, targetNetwork, targetAddress, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addrConn{
+		Conn:       conn,
+		remoteAddr: &genericAddr{network: network, address: address},
+	}, nil
+}
+
+// dialTarget connects to the address on the named network, resolved IPs are checked against the IP policy and Unix
+// socket paths are mapped to host paths unless rewritten by the host. Addresses served by handlers and custom dial
+// function don't reach the network, with namespace configured nothing reaches the network.
+func (d *Dialer) dialTarget(ctx context.Context, network, address string, rewritten bool) (net.Conn, error) {
+	if handler, ok := d.handlers[address]; ok {
+		return serveHandler(handler, network, address), nil
+	}
+
+	if d.ns != nil {
+		return d.ns.dial(ctx, network, address)
+	}
+
+	if d.custom != nil {
+		return d.custom(ctx, network, address)
+	}
+
+	if isUnixNetwork(network) {
+		if rewritten {
+			// Rewrite targets are configured by the host, so they are used as is
+			return d.dialer.DialContext(ctx, network, address)
+		}
+		return d.dialUnix(ctx, network, address)
+	}
+
+	if isRawIPNetwork(network) {
+		return d.dialRawIP(ctx, network, address)
+	}
+
+	if !isIPNetwork(network) {
+		return nil, fmt.Errorf("%w: unsupported network: %s", internal.ErrPermissionDenied, network)
+	}
+
+	addrPorts, err := d.resolve(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErrs []error
+	for _, addrPort := range addrPorts {
+		var conn net.Conn
+		if d.proxy.use(network, address, addrPort) {
+			conn, err = d.proxy.dial(ctx, addrPort.String())
+		} else {
+			conn, err = d.dialer.DialContext(ctx, network, addrPort.String())
+		}
+		if err == nil {
+			return conn, nil
+		}
+		dialErrs = append(dialErrs, err)
+	}
+
+	return nil, errors.Join(dialErrs...)
+}
+
+// dialRawIP connects to the host on the raw IP network, resolved IPs are checked against the IP policy.
+func (d *Dialer) dialRawIP(ctx context.Context, network, address string) (net.Conn, error) {
+	ips, err := d.resolveIPs(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErrs []error
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, ip.String())
+		if err == nil {
+			return conn, nil
+		}
+		dialErrs = append(dialErrs, err)
+	}
+
+	return nil, errors.Join(dialErrs...)
+}
+
+// dialUnix connects to the Unix socket mapped from the guest path.
+func (d *Dialer) dialUnix(ctx context.Context, network, address string) (net.Conn, error) {
+	hostPath, err := d.unix.hostPath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.dialer.DialContext(ctx, network, hostPath)
+	if err != nil || d.unix == nil {
+		return conn, err
+	}
+
+	return &addrConn{
+		Conn:       conn,
+		remoteAddr: &net.UnixAddr{Name: address, Net: network},
+	}, nil
+}
+
+// DialTLSContext connects to the address on the named network if allowed and performs TLS handshake.
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string, cfg TLSConfig) (net.Conn, error) {
+	if d.cassette.replaying() {
+		return d.replay(ctx, network, address, true)
+	}
+
+	conn, err := d.dialTLSContext(ctx, network, address, cfg)
+	return d.cassette.record(network, address, true, d.hasCredentials(address), conn, err)
+}
+
+// dialTLSContext connects to the address on the named network if allowed and performs TLS handshake. Client
+// certificates of credentials matching the address are used for mutual TLS.
+func (d *Dialer) dialTLSContext(ctx context.Context, network, address string, cfg TLSConfig) (net.Conn, error) {
+	clientCertificates, err := d.credentials.clientCertificates(address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.dialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Server name is verified against the host that is actually dialed
+	target := address
+	if _, targetAddress, ok := d.rewrites.rewrite(network, address); ok {
+		target = targetAddress
+	}
+
+	if _, ok := d.handlers[target]; ok {
+		// TLS is terminated in-process, connection is a plaintext stream anyway
+		return conn, nil
+	}
+
+	tlsConfig, err := cfg.ClientConfig(address, target)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if clientCertificates != nil {
+		tlsConfig.Certificates = clientCertificates
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// resolve resolves the address to the list of IPs allowed by the IP policy with the port, see [Dialer.resolveIPs].
+func (d *Dialer) resolve(ctx context.Context, network, address string) ([]netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := net.DefaultResolver.LookupPort(ctx, network, portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := d.resolveIPs(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrPorts := make([]netip.AddrPort, 0, len(ips))
+	for _, ip := range ips {
+		addrPorts = append(addrPorts, netip.AddrPortFrom(ip, uint16(port)))
+	}
+
+	return addrPorts, nil
+}
+
+// resolveIPs resolves the host to the list of IPs allowed by the IP policy, returns an error if none of them are
+// allowed. Empty host and unspecified IPs are replaced by loopback IPs, as they connect to the local system.
+func (d *Dialer) resolveIPs(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	var ips []netip.Addr
+	if host == "" {
+		ips = []netip.Addr{netip.IPv4Unspecified()}
+	} else {
+		var err error
+		ips, err = d.resolver.lookupNetIP(ctx, ipNetwork(network), host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	allowed := make([]netip.Addr, 0, len(ips))
+	var policyErr error
+	for _, ip := range ips {
+		ip = ip.Unmap()
+		if ip.IsUnspecified() {
+			if ip.Is4() {
+				ip = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+			} else {
+				ip = netip.IPv6Loopback()
+			}
+		}
+
+		if err := d.ipPolicy.check(ip); err != nil {
+			policyErr = err
+			continue
+		}
+
+		allowed = append(allowed, ip)
+	}
+
+	if len(allowed) == 0 {
+		if policyErr == nil {
+			policyErr = fmt.Errorf("no IPs resolved: %s", host)
+		}
+		return nil, policyErr
+	}
+
+	return allowed, nil
+}
+
+// isIPNetwork reports whether the network is TCP or UDP network.
+func isIPNetwork(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		return true
+	default:
+		return false
+	}
+}
+
+// isRawIPNetwork reports whether the network is raw IP network ("ip", "ip4:1", "ip6:ipv6-icmp").
+func isRawIPNetwork(network string) bool {
+	network, _, _ = strings.Cut(network, ":")
+	switch network {
+	case "ip", "ip4", "ip6":
+		return true
+	default:
+		return false
+	}
+}
+
+// ipNetwork returns IP network for TCP, UDP or raw IP network.
+func ipNetwork(network string) string {
+	network, _, _ = strings.Cut(network, ":")
+	switch network {
+	case "tcp4", "udp4", "ip4":
+		return "ip4"
+	case "tcp6", "udp6", "ip6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
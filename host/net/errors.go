@@ -0,0 +1,13 @@
+package net
+
+import "github.com/mymmrac/wape/internal"
+
+// Errors reported to the guest as distinct error codes.
+var (
+	ErrPermissionDenied = internal.ErrPermissionDenied
+
+	ErrConnectionLimit  = internal.ErrConnectionLimit
+	ErrByteLimit        = internal.ErrByteLimit
+	ErrIdleTimeout      = internal.ErrIdleTimeout
+	ErrLifetimeExceeded = internal.ErrLifetimeExceeded
+)
@@ -0,0 +1,93 @@
+package net
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// serveHandler returns client side of in-memory connection served by the HTTP handler.
+func serveHandler(handler http.Handler, network, address string) net.Conn {
+	clientConn, serverConn := net.Pipe()
+
+	listener := &connListener{
+		conn: &pipeConn{
+			Conn:   serverConn,
+			local:  &genericAddr{network: network, address: address},
+			remote: &genericAddr{network: network, address: "memory"},
+		},
+		done: make(chan struct{}),
+	}
+	listener.conn.onClose = listener.close
+
+	server := &http.Server{
+		Handler: handler,
+	}
+	go func() { _ = server.Serve(listener) }()
+
+	return &pipeConn{
+		Conn:   clientConn,
+		local:  &genericAddr{network: network, address: "memory"},
+		remote: &genericAddr{network: network, address: address},
+	}
+}
+
+// connListener is a listener that accepts a single connection and is closed once the connection is closed, so
+// [http.Server] serving it stops with the connection.
+type connListener struct {
+	conn     *pipeConn
+	accepted bool
+	done     chan struct{}
+	once     sync.Once
+	lock     sync.Mutex
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	if !l.accepted {
+		l.accepted = true
+		l.lock.Unlock()
+		return l.conn, nil
+	}
+	l.lock.Unlock()
+
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.close()
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// close closes the listener, it's safe to call multiple times.
+func (l *connListener) close() {
+	l.once.Do(func() { close(l.done) })
+}
+
+// pipeConn is an in-memory connection with meaningful addresses.
+type pipeConn struct {
+	net.Conn
+	local   net.Addr
+	remote  net.Addr
+	onClose func()
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *pipeConn) Close() error {
+	if c.onClose != nil {
+		c.onClose()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,213 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ReadHostsFile reads static hosts from a file in hosts file format (see hosts(5)), each line contains an IP followed
+// by one or more host names, comments start with "#".
+func ReadHostsFile(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	return ReadHosts(file)
+}
+
+// ReadHosts reads static hosts in hosts file format, see [ReadHostsFile].
+func ReadHosts(r io.Reader) (map[string][]string, error) {
+	hosts := make(map[string][]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("invalid hosts line: %q", line)
+		}
+
+		for _, name := range fields[1:] {
+			hosts[name] = append(hosts[name], fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// resolver resolves names using static hosts first and DNS second.
+type resolver struct {
+	hosts     map[string][]netip.Addr
+	hostsOnly bool
+	resolver  *net.Resolver
+
+	// err is set if hosts file can't be read or any of static hosts is invalid, in that case all lookups fail
+	err error
+}
+
+// newResolver creates a new resolver, static hosts from the hosts file (if any) are merged with hosts.
+func newResolver(hosts map[string][]string, hostsFile string, hostsOnly bool) *resolver {
+	r := &resolver{
+		hosts:     make(map[string][]netip.Addr, len(hosts)),
+		hostsOnly: hostsOnly,
+		resolver:  net.DefaultResolver,
+	}
+
+	if hostsFile != "" {
+		fileHosts, err := ReadHostsFile(hostsFile)
+		if err != nil {
+			r.err = fmt.Errorf("read hosts file: %w", err)
+			return r
+		}
+		if err = r.addHosts(fileHosts); err != nil {
+			r.err = err
+			return r
+		}
+	}
+
+	if err := r.addHosts(hosts); err != nil {
+		r.err = err
+	}
+
+	return r
+}
+
+// addHosts parses and adds static hosts.
+func (r *resolver) addHosts(hosts map[string][]string) error {
+	for name, ips := range hosts {
+		name = normalizeHost(name)
+		for _, ipStr := range ips {
+			ip, err := netip.ParseAddr(ipStr)
+			if err != nil {
+				return fmt.Errorf("invalid static host %q: %w", name, err)
+			}
+			r.hosts[name] = append(r.hosts[name], ip)
+		}
+	}
+
+	return nil
+}
+
+// lookupNetIP looks up host, see [net.Resolver.LookupNetIP].
+func (r *resolver) lookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+
+	if ips, ok := r.hosts[normalizeHost(host)]; ok {
+		ips = slices.DeleteFunc(slices.Clone(ips), func(ip netip.Addr) bool {
+			return network == "ip4" && !ip.Unmap().Is4() || network == "ip6" && ip.Is4()
+		})
+		if len(ips) == 0 {
+			return nil, notFoundError(host)
+		}
+		return ips, nil
+	}
+
+	if r.hostsOnly {
+		return nil, notFoundError(host)
+	}
+
+	return r.resolver.LookupNetIP(ctx, network, host)
+}
+
+// lookupHost looks up host, see [net.Resolver.LookupHost].
+func (r *resolver) lookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := r.lookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+
+	return addresses, nil
+}
+
+// lookupIP looks up host, see [net.Resolver.LookupIP].
+func (r *resolver) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, err := r.lookupNetIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	netIPs := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		netIPs = append(netIPs, ip.AsSlice())
+	}
+
+	return netIPs, nil
+}
+
+// lookupCNAME looks up canonical name, see [net.Resolver.LookupCNAME]. Static hosts are canonical names of
+// themselves.
+func (r *resolver) lookupCNAME(ctx context.Context, host string) (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+
+	if _, ok := r.hosts[normalizeHost(host)]; ok {
+		return normalizeHost(host) + ".", nil
+	}
+
+	if r.hostsOnly {
+		return "", notFoundError(host)
+	}
+
+	return r.resolver.LookupCNAME(ctx, host)
+}
+
+// lookupSRV looks up SRV records, see [net.Resolver.LookupSRV].
+func (r *resolver) lookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if r.hostsOnly {
+		return "", nil, notFoundError(name)
+	}
+	return r.resolver.LookupSRV(ctx, service, proto, name)
+}
+
+// lookupTXT looks up TXT records, see [net.Resolver.LookupTXT].
+func (r *resolver) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.hostsOnly {
+		return nil, notFoundError(name)
+	}
+	return r.resolver.LookupTXT(ctx, name)
+}
+
+// lookupMX looks up MX records, see [net.Resolver.LookupMX].
+func (r *resolver) lookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if r.hostsOnly {
+		return nil, notFoundError(name)
+	}
+	return r.resolver.LookupMX(ctx, name)
+}
+
+// notFoundError returns DNS error for not found name.
+func notFoundError(name string) error {
+	return &net.DNSError{
+		Err:        "no such host",
+		Name:       name,
+		IsNotFound: true,
+	}
+}
@@ -0,0 +1,396 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+
+	wnet "github.com/mymmrac/wape/host/net"
+	"github.com/mymmrac/wape/internal"
+)
+
+// DoConfig configures [Do].
+type DoConfig struct {
+	// URLsAllowed configures the allowed request URLs as patterns matched against URL without query and fragment.
+	// Pattern consists of scheme, host and path, for example "https://*.example.com/v1/*/items". Scheme is matched
+	// exactly, host with optional port is matched as [wnet.AddressRule] (port defaults to the scheme default port, CIDR
+	// blocks are enclosed in square brackets, for example "http://[10.0.0.0/8]:8080/"), path is matched segment by
+	// segment after dot segments are removed, "*" matches a single segment (see [path.Match]) and "**" as the last
+	// segment matches the rest of the path. URLs with user info are never allowed. Defaults to none.
+	URLsAllowed []string
+	// URLsAllowAll allows all request URLs. Defaults to false.
+	URLsAllowAll bool
+
+	// MethodsAllowed configures the allowed request methods. Defaults to all.
+	MethodsAllowed []string
+
+	// HeadersAllowed configures the allowed request headers, other headers are removed. Defaults to all.
+	HeadersAllowed []string
+	// HeadersDenied configures the denied request headers that are removed. Takes priority over allowed headers.
+	// Defaults to none.
+	HeadersDenied []string
+
+	// MaxRequestBodySize limits the request body size in bytes. Defaults to 0 (no limit).
+	MaxRequestBodySize int64
+	// MaxResponseBodySize limits the response body size in bytes. Defaults to 0 (no limit).
+	MaxResponseBodySize int64
+}
+
+// Request is the HTTP request sent by the guest.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Response is the HTTP response returned to the guest.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Do creates a host function that executes HTTP requests on the host. Connections are dialed using [wnet.Dialer], so
+// dial configuration is applied as well. Redirects are not followed, so each redirect is checked by the policy
+// separately and credentials are never sent to redirect targets. Credentials matching the request host are added after
+// guest headers are filtered, so they can't be overridden or observed by the guest.
+func Do(cfg DoConfig, dialCfg wnet.DialConfig, tlsCfg wnet.TLSConfig) extism.HostFunction {
+	dialer := wnet.NewDialer(dialCfg)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if dialCfg.Quota.MaxConnections() > 0 {
+		// Idle connections would hold connection quota of the guest, so they are not kept
+		transport.DisableKeepAlives = true
+	}
+	transport.DialContext = dialer.DialContext
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialTLSContext(ctx, network, addr, tlsCfg)
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return internal.NewHostFunction("http.do",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			requestData, err := internal.ReadBytes(p, stack[0])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			var request Request
+			if err = json.Unmarshal(requestData, &request); err != nil {
+				resources.Fail(fmt.Errorf("%w: decode request: %w", internal.ErrInvalidArgument, err))
+				stack[0] = 0
+				return
+			}
+
+			httpRequest, err := cfg.newRequest(ctx, request)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = dialCfg.Credentials.ApplyHTTP(httpRequest); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			httpResponse, err := client.Do(httpRequest)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+			defer func() { _ = httpResponse.Body.Close() }()
+
+			response, err := cfg.readResponse(httpResponse)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			responseData, err := json.Marshal(response)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			responsePtr, err := p.WriteBytes(responseData)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = responsePtr
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* request */},
+		[]extism.ValueType{extism.ValueTypePTR /* response */},
+	)
+}
+
+// newRequest checks the request against the configuration and creates an HTTP request.
+func (cfg DoConfig) newRequest(ctx context.Context, request Request) (*http.Request, error) {
+	if request.Method == "" {
+		request.Method = http.MethodGet
+	}
+
+	if len(cfg.MethodsAllowed) > 0 && !slices.ContainsFunc(cfg.MethodsAllowed, func(method string) bool {
+		return strings.EqualFold(method, request.Method)
+	}) {
+		return nil, fmt.Errorf("%w: method not allowed: %s", internal.ErrPermissionDenied, request.Method)
+	}
+
+	if cfg.MaxRequestBodySize > 0 && int64(len(request.Body)) > cfg.MaxRequestBodySize {
+		return nil, fmt.Errorf("%w: request body too large: %d bytes", internal.ErrByteLimit, len(request.Body))
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, request.Method, request.URL, bytes.NewReader(request.Body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", internal.ErrInvalidArgument, err)
+	}
+
+	if httpRequest.URL.Scheme != "http" && httpRequest.URL.Scheme != "https" {
+		return nil, fmt.Errorf("%w: unsupported URL scheme: %s", internal.ErrPermissionDenied, httpRequest.URL.Scheme)
+	}
+
+	if httpRequest.URL.User != nil {
+		return nil, fmt.Errorf("%w: URL with user info not allowed", internal.ErrPermissionDenied)
+	}
+
+	if httpRequest.URL.Opaque != "" {
+		return nil, fmt.Errorf("%w: opaque URL not supported", internal.ErrInvalidArgument)
+	}
+
+	// URL is checked and sent with the same normalized path, so dot segments can't escape allowed paths
+	cleanPath := cleanURLPath(httpRequest.URL.Path)
+	if cleanPath != httpRequest.URL.Path {
+		httpRequest.URL.Path = cleanPath
+		httpRequest.URL.RawPath = ""
+	}
+
+	if !cfg.URLsAllowAll {
+		allowed, err := cfg.urlAllowed(httpRequest.URL)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: URL not allowed: %s", internal.ErrPermissionDenied, urlWithoutQuery(httpRequest))
+		}
+	}
+
+	for name, values := range request.Header {
+		if !cfg.headerAllowed(name) {
+			continue
+		}
+		for _, value := range values {
+			httpRequest.Header.Add(name, value)
+		}
+	}
+
+	return httpRequest, nil
+}
+
+// headerAllowed reports whether the request header is allowed.
+func (cfg DoConfig) headerAllowed(name string) bool {
+	equalName := func(header string) bool {
+		return strings.EqualFold(header, name)
+	}
+
+	if slices.ContainsFunc(cfg.HeadersDenied, equalName) {
+		return false
+	}
+
+	return len(cfg.HeadersAllowed) == 0 || slices.ContainsFunc(cfg.HeadersAllowed, equalName)
+}
+
+// readResponse reads the HTTP response respecting the configuration.
+func (cfg DoConfig) readResponse(httpResponse *http.Response) (Response, error) {
+	var body io.Reader = httpResponse.Body
+	if cfg.MaxResponseBodySize > 0 {
+		body = io.LimitReader(httpResponse.Body, cfg.MaxResponseBodySize+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if cfg.MaxResponseBodySize > 0 && int64(len(data)) > cfg.MaxResponseBodySize {
+		return Response{}, fmt.Errorf("%w: response body too large: more than %d bytes", internal.ErrByteLimit,
+			cfg.MaxResponseBodySize)
+	}
+
+	return Response{
+		StatusCode: httpResponse.StatusCode,
+		Header:     httpResponse.Header,
+		Body:       data,
+	}, nil
+}
+
+// urlWithoutQuery returns request URL without query and fragment.
+func urlWithoutQuery(httpRequest *http.Request) string {
+	u := *httpRequest.URL
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// Validate returns an error if any of URL patterns is invalid, requests made with invalid configuration are denied.
+func (cfg DoConfig) Validate() error {
+	for _, pattern := range cfg.URLsAllowed {
+		if _, err := parseURLPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// urlAllowed reports whether the URL matches any of allowed URL patterns, returns an error if any of patterns is
+// invalid.
+func (cfg DoConfig) urlAllowed(u *url.URL) (bool, error) {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+
+	for _, rawPattern := range cfg.URLsAllowed {
+		pattern, err := parseURLPattern(rawPattern)
+		if err != nil {
+			return false, err
+		}
+
+		if pattern.match(u.Scheme, address, segments) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// urlPattern is a compiled URL pattern, see [DoConfig.URLsAllowed] for syntax.
+type urlPattern struct {
+	scheme string
+	host   wnet.AddressRule
+	path   []string
+}
+
+// parseURLPattern parses URL pattern.
+func parseURLPattern(pattern string) (urlPattern, error) {
+	scheme, rest, ok := strings.Cut(pattern, "://")
+	if !ok {
+		return urlPattern{}, fmt.Errorf("invalid URL pattern %q: missing scheme", pattern)
+	}
+	scheme = strings.ToLower(scheme)
+
+	port := defaultPort(scheme)
+	if port == "" {
+		return urlPattern{}, fmt.Errorf("invalid URL pattern %q: unsupported scheme: %s", pattern, scheme)
+	}
+
+	// CIDR block hosts are enclosed in square brackets, so their "/" doesn't start the path
+	pathStart := 0
+	if strings.HasPrefix(rest, "[") {
+		pathStart = max(strings.Index(rest, "]"), 0)
+	}
+	authority, patternPath, _ := strings.Cut(rest[pathStart:], "/")
+	authority = rest[:pathStart] + authority
+	if strings.Contains(authority, "@") {
+		return urlPattern{}, fmt.Errorf("invalid URL pattern %q: user info not supported", pattern)
+	}
+
+	if i := strings.LastIndex(authority, ":"); i < 0 || i < strings.LastIndex(authority, "]") {
+		authority += ":" + port
+	}
+
+	host, err := wnet.ParseAddressRule(authority)
+	if err != nil {
+		return urlPattern{}, fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(cleanURLPath(patternPath), "/"), "/")
+	for _, segment := range segments {
+		if _, err = path.Match(segment, ""); err != nil {
+			return urlPattern{}, fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+		}
+	}
+
+	return urlPattern{
+		scheme: scheme,
+		host:   host,
+		path:   segments,
+	}, nil
+}
+
+// match reports whether URL with the scheme, host address and path segments matches the pattern.
+func (p urlPattern) match(scheme, address string, segments []string) bool {
+	if scheme != p.scheme || !p.host.Match(address) {
+		return false
+	}
+
+	for i, segment := range p.path {
+		if segment == "**" && i == len(p.path)-1 {
+			return true
+		}
+
+		if i >= len(segments) {
+			return false
+		}
+
+		if matched, _ := path.Match(segment, segments[i]); !matched {
+			return false
+		}
+	}
+
+	return len(p.path) == len(segments)
+}
+
+// cleanURLPath returns the shortest absolute path equivalent to the URL path, see [path.Clean]. Trailing slash is
+// kept, as it may be significant for the server.
+func cleanURLPath(urlPath string) string {
+	cleanPath := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleanPath != "/" {
+		cleanPath += "/"
+	}
+	return cleanPath
+}
+
+// defaultPort returns the default port of the URL scheme, returns empty string for unsupported schemes.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	default:
+		return ""
+	}
+}
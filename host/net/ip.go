@@ -0,0 +1,161 @@
+package net
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// IP rule presets.
+const (
+	IPPresetLoopback    = "loopback"
+	IPPresetPrivate     = "private"
+	IPPresetLinkLocal   = "link-local"
+	IPPresetMulticast   = "multicast"
+	IPPresetUnspecified = "unspecified"
+	IPPresetInternal    = "internal"
+)
+
+// Carrier-grade NAT and NAT64 prefixes, matched by "private" preset.
+var (
+	cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+// isPrivate reports whether IP is private, carrier-grade NAT or NAT64 address.
+func isPrivate(ip netip.Addr) bool {
+	return ip.IsPrivate() || cgnatPrefix.Contains(ip) || nat64Prefix.Contains(ip)
+}
+
+// IPRule is a rule that matches IP addresses.
+//
+// Rule can be an exact IP ("10.0.0.1", "::1"), a CIDR block ("10.0.0.0/8", "fd00::/8") or one of the presets:
+//   - "loopback" matches loopback addresses (127.0.0.0/8, ::1)
+//   - "private" matches private addresses (10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, fc00::/7), carrier-grade NAT
+//     addresses (100.64.0.0/10) and NAT64 addresses (64:ff9b::/96) that may translate to private IPv4 addresses
+//   - "link-local" matches link-local unicast and multicast addresses (169.254.0.0/16, fe80::/10, 224.0.0.0/24,
+//     ff02::/16)
+//   - "multicast" matches multicast addresses
+//   - "unspecified" matches unspecified addresses (0.0.0.0, ::)
+//   - "internal" matches all addresses from presets above, effectively everything that is not a public address
+//
+// IPv4-mapped IPv6 addresses are matched as IPv4 addresses.
+type IPRule struct {
+	raw   string
+	match func(ip netip.Addr) bool
+}
+
+// ParseIPRule parses IP rule, see [IPRule] for syntax.
+func ParseIPRule(rule string) (IPRule, error) {
+	r := IPRule{
+		raw: rule,
+	}
+
+	switch strings.ToLower(rule) {
+	case IPPresetLoopback:
+		r.match = netip.Addr.IsLoopback
+	case IPPresetPrivate:
+		r.match = isPrivate
+	case IPPresetLinkLocal:
+		r.match = func(ip netip.Addr) bool {
+			return ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+		}
+	case IPPresetMulticast:
+		r.match = netip.Addr.IsMulticast
+	case IPPresetUnspecified:
+		r.match = netip.Addr.IsUnspecified
+	case IPPresetInternal:
+		r.match = func(ip netip.Addr) bool {
+			return ip.IsLoopback() || isPrivate(ip) || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+				ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+		}
+	default:
+		if strings.Contains(rule, "/") {
+			prefix, err := netip.ParsePrefix(rule)
+			if err != nil {
+				return IPRule{}, fmt.Errorf("invalid IP rule %q: %w", rule, err)
+			}
+			prefix = prefix.Masked()
+
+			r.match = prefix.Contains
+			break
+		}
+
+		ruleIP, err := netip.ParseAddr(rule)
+		if err != nil {
+			return IPRule{}, fmt.Errorf("invalid IP rule %q: %w", rule, err)
+		}
+		ruleIP = ruleIP.Unmap()
+
+		r.match = func(ip netip.Addr) bool {
+			return ip == ruleIP
+		}
+	}
+
+	return r, nil
+}
+
+// String returns the rule as it was parsed.
+func (r IPRule) String() string {
+	return r.raw
+}
+
+// Match reports whether the IP matches the rule.
+func (r IPRule) Match(ip netip.Addr) bool {
+	return r.match(ip.Unmap())
+}
+
+// ipPolicy is a compiled IP policy.
+type ipPolicy struct {
+	allowed []IPRule
+	denied  []IPRule
+
+	// err is set if any of IP rules is invalid, in that case everything is denied
+	err error
+}
+
+// newIPPolicy compiles IP policy.
+func newIPPolicy(allowed, denied []string) *ipPolicy {
+	p := &ipPolicy{}
+
+	p.allowed, p.err = parseIPRules(allowed)
+	if p.err != nil {
+		return p
+	}
+
+	p.denied, p.err = parseIPRules(denied)
+	return p
+}
+
+// check returns an error if IP is not allowed, if no allowed rules provided all IPs are allowed.
+func (p *ipPolicy) check(ip netip.Addr) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	if slices.ContainsFunc(p.denied, func(rule IPRule) bool { return rule.Match(ip) }) {
+		return fmt.Errorf("%w: IP denied: %s", internal.ErrPermissionDenied, ip)
+	}
+
+	if len(p.allowed) > 0 && !slices.ContainsFunc(p.allowed, func(rule IPRule) bool { return rule.Match(ip) }) {
+		return fmt.Errorf("%w: IP not allowed: %s", internal.ErrPermissionDenied, ip)
+	}
+
+	return nil
+}
+
+// parseIPRules parses all IP rules.
+func parseIPRules(rules []string) ([]IPRule, error) {
+	parsedRules := make([]IPRule, 0, len(rules))
+	for _, rule := range rules {
+		parsedRule, err := ParseIPRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsedRules = append(parsedRules, parsedRule)
+	}
+	return parsedRules, nil
+}
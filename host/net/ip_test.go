@@ -0,0 +1,145 @@
+package net
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+func TestParseIPRuleInvalid(t *testing.T) {
+	rules := []string{
+		"",
+		"example.com",
+		"10.0.0",
+		"10.0.0.0/33",
+		"fd00::/129",
+		"10.0.0.0/8/8",
+		"[::1]",
+	}
+
+	for _, rule := range rules {
+		if _, err := ParseIPRule(rule); err == nil {
+			t.Errorf("expected error for rule %q", rule)
+		}
+	}
+}
+
+func TestIPRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule  string
+		ip    string
+		match bool
+	}{
+		// Exact IPs and CIDR blocks
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.1", "10.0.0.2", false},
+		{"::ffff:10.0.0.1", "10.0.0.1", true},
+		{"::1", "::1", true},
+		{"10.0.0.0/8", "10.255.0.1", true},
+		{"10.1.2.3/8", "10.200.0.1", true},
+		{"10.0.0.0/8", "11.0.0.1", false},
+		{"fd00::/8", "fd12::1", true},
+		{"fd00::/8", "fe80::1", false},
+
+		// IPv4-mapped IPv6 addresses are matched as IPv4 addresses
+		{"10.0.0.0/8", "::ffff:10.1.2.3", true},
+		{"10.0.0.1", "::ffff:10.0.0.1", true},
+		{"loopback", "::ffff:127.0.0.1", true},
+		{"private", "::ffff:192.168.1.1", true},
+
+		// Loopback
+		{"loopback", "127.0.0.1", true},
+		{"loopback", "127.1.2.3", true},
+		{"loopback", "::1", true},
+		{"loopback", "10.0.0.1", false},
+		{"LOOPBACK", "127.0.0.1", true},
+
+		// Private, including carrier-grade NAT and NAT64
+		{"private", "10.1.2.3", true},
+		{"private", "172.16.0.1", true},
+		{"private", "172.32.0.1", false},
+		{"private", "192.168.0.1", true},
+		{"private", "fd00::1", true},
+		{"private", "100.64.0.1", true},
+		{"private", "100.127.255.254", true},
+		{"private", "100.128.0.1", false},
+		{"private", "64:ff9b::a00:1", true},
+		{"private", "64:ff9b:1::a00:1", false},
+		{"private", "8.8.8.8", false},
+
+		// Link-local unicast and multicast
+		{"link-local", "169.254.169.254", true},
+		{"link-local", "fe80::1", true},
+		{"link-local", "224.0.0.251", true},
+		{"link-local", "ff02::fb", true},
+		{"link-local", "224.0.1.1", false},
+		{"link-local", "10.0.0.1", false},
+
+		// Multicast and unspecified
+		{"multicast", "239.1.2.3", true},
+		{"multicast", "ff05::1", true},
+		{"multicast", "10.0.0.1", false},
+		{"unspecified", "0.0.0.0", true},
+		{"unspecified", "::", true},
+		{"unspecified", "10.0.0.1", false},
+
+		// Internal covers everything that is not a public address
+		{"internal", "127.0.0.1", true},
+		{"internal", "10.0.0.1", true},
+		{"internal", "100.64.0.1", true},
+		{"internal", "64:ff9b::a00:1", true},
+		{"internal", "169.254.169.254", true},
+		{"internal", "ff01::1", true},
+		{"internal", "239.1.2.3", true},
+		{"internal", "0.0.0.0", true},
+		{"internal", "::ffff:169.254.169.254", true},
+		{"internal", "8.8.8.8", false},
+		{"internal", "2001:4860:4860::8888", false},
+	}
+
+	for _, test := range tests {
+		rule, err := ParseIPRule(test.rule)
+		if err != nil {
+			t.Fatalf("parse rule %q: %v", test.rule, err)
+		}
+
+		if match := rule.Match(netip.MustParseAddr(test.ip)); match != test.match {
+			t.Errorf("rule %q, IP %s: expected match %t, got %t", test.rule, test.ip, test.match, match)
+		}
+	}
+}
+
+func TestIPPolicyDenyPrecedence(t *testing.T) {
+	p := newIPPolicy([]string{"10.0.0.0/8", "private"}, []string{"10.0.0.1", "100.64.0.0/10"})
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.0.0.2", true},
+		{"192.168.1.1", true},
+		{"10.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"100.64.0.1", false},
+		{"8.8.8.8", false},
+	}
+
+	for _, test := range tests {
+		err := p.check(netip.MustParseAddr(test.ip))
+		if test.allowed && err != nil {
+			t.Errorf("%s: expected to be allowed, got: %v", test.ip, err)
+		}
+		if !test.allowed && !errors.Is(err, internal.ErrPermissionDenied) {
+			t.Errorf("%s: expected permission denied, got: %v", test.ip, err)
+		}
+	}
+
+	if err := newIPPolicy(nil, nil).check(netip.MustParseAddr("8.8.8.8")); err != nil {
+		t.Errorf("expected all IPs to be allowed without rules, got: %v", err)
+	}
+	if err := newIPPolicy(nil, []string{"10.0.0.0/33"}).check(netip.MustParseAddr("8.8.8.8")); err == nil {
+		t.Error("expected invalid rule to deny everything")
+	}
+}
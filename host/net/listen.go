@@ -0,0 +1,171 @@
+package net
+
+import (
+	"context"
+	"net"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// ListenConfig configures [Listen].
+type ListenConfig struct {
+	// ListenFilter allows to create custom filtering for listen networks and addresses.
+	// Takes priority over networks and addresses configurations if present. Defaults to nil.
+	ListenFilter func(ctx context.Context, network, address string) (bool, error)
+
+	// ListenNetworksAllowed configures the allowed network protocols to listen on. See [net.Listen] for allowed
+	// protocols. Defaults to none.
+	ListenNetworksAllowed []string
+	// ListenNetworksAllowAll allows to listen on all network protocols. Defaults to false.
+	ListenNetworksAllowAll bool
+
+	// ListenAddressesAllowed configures the allowed bind addresses, see [AddressRule] for syntax. Defaults to none.
+	ListenAddressesAllowed []string
+	// ListenAddressesAllowAll allows to bind on all addresses. Defaults to false.
+	ListenAddressesAllowAll bool
+
+	// Quota configures network usage limits shared with other host functions, accepted connections and packet
+	// connections count towards it, see [NewQuota]. Defaults to no limits.
+	Quota *Quota
+
+	// Namespace configures virtual network, listeners are created in it instead of the host network, see [Namespace].
+	// Packet connections are refused, as the namespace has no packet transport. Defaults to nil.
+	Namespace *Namespace
+}
+
+// policy returns compiled listen policy.
+func (cfg ListenConfig) policy() *policy {
+	return newPolicy(cfg.ListenFilter, cfg.ListenNetworksAllowed, cfg.ListenNetworksAllowAll,
+		cfg.ListenAddressesAllowed, nil, cfg.ListenAddressesAllowAll)
+}
+
+// Validate returns an error if any of address rules is invalid, listen host functions created with invalid
+// configuration deny everything.
+func (cfg ListenConfig) Validate() error {
+	return cfg.policy().err
+}
+
+// Listen creates a host function that calls [net.Listen], or creates a virtual listener if namespace is configured.
+func Listen(cfg ListenConfig) extism.HostFunction {
+	listenPolicy := cfg.policy()
+	return internal.NewHostFunction("net.listen",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			network, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			addr, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			if err = listenPolicy.check(ctx, network, addr); err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			var listener net.Listener
+			if cfg.Namespace != nil {
+				listener, err = cfg.Namespace.listen(network, addr)
+			} else {
+				listenConfig := &net.ListenConfig{}
+				listener, err = listenConfig.Listen(ctx, network, addr)
+			}
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			listenerID, ok := resources.Listeners.Add(listener)
+			if !ok {
+				_ = listener.Close()
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			stack[0] = extism.EncodeI32(listenerID)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* network */, extism.ValueTypePTR /* address */},
+		[]extism.ValueType{extism.ValueTypeI32 /* listenerID | errorCode */},
+	)
+}
+
+// ListenerAccept accepts the next connection of a listener.
+// Accepted connection is closed and [ErrConnectionLimit] is reported if quota has no connections left.
+func ListenerAccept(cfg ListenConfig) extism.HostFunction {
+	return internal.NewHostFunction("net.listener.accept",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			listenerID := extism.DecodeI32(stack[0])
+
+			listener, ok := resources.Listeners.Get(listenerID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			op := internal.NewIOOperation()
+			handle, ok := resources.IOHandles.Add(op)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			quota := cfg.Quota.plugin(ctx)
+			cancel, restore := acceptInterrupt(listener)
+			op.Go(ctx, func() (int, error) {
+				conn, err := listener.Accept()
+				if err == nil {
+					conn, err = quota.wrapConn(conn)
+				}
+				if err != nil {
+					return 0, err
+				}
+
+				connID, ok := resources.Connections.Add(newCancelConn(conn))
+				if !ok {
+					_ = conn.Close()
+					return 0, internal.ErrNoHandles
+				}
+
+				return int(connID), nil
+			}, cancel, restore)
+
+			stack[0] = extism.EncodeI32(handle)
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* listenerID */},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle | errorCode */},
+	)
+}
+
+// ListenerClose closes the listener.
+func ListenerClose() extism.HostFunction {
+	return internal.NewHostFunction("net.listener.close",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			listenerID := extism.DecodeI32(stack[0])
+
+			listener, ok := resources.Listeners.Remove(listenerID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := listener.Close(); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* listenerID */},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
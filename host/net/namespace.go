@@ -0,0 +1,279 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// namespaces is the registry of named namespaces.
+var namespaces = internal.NewSyncMap[string, *Namespace]()
+
+// namespaceBacklog is the number of connections waiting to be accepted by virtual listener.
+const namespaceBacklog = 128
+
+// Namespace is a virtual network that plugins use to talk to each other without touching the host network stack.
+//
+// Listeners created in the namespace are virtual and connections dialed to their addresses are routed through
+// in-memory pipes. Listeners on unspecified host (":8080", "0.0.0.0:8080", "[::]:8080") accept connections dialed to
+// any host with the same port, other listeners accept connections dialed to the exact address. Only stream networks are
+// supported, TCP networks are treated as the same network. Dials to addresses without listeners are refused, so guests
+// in a namespace never reach the host network.
+type Namespace struct {
+	listeners map[string]*virtualListener
+	port      int
+	lock      sync.Mutex
+}
+
+// NewNamespace creates a new namespace.
+func NewNamespace() *Namespace {
+	return &Namespace{
+		listeners: make(map[string]*virtualListener),
+		port:      49151,
+	}
+}
+
+// LookupNamespace returns the namespace with the name, namespace is created if it doesn't exist yet.
+func LookupNamespace(name string) *Namespace {
+	return namespaces.GetOrSet(name, NewNamespace)
+}
+
+// namespaceNetwork returns the network family used as a part of listener key.
+func namespaceNetwork(network string) (string, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return "tcp", nil
+	case "unix", "unixpacket":
+		return network, nil
+	default:
+		return "", fmt.Errorf("unsupported virtual network: %s", network)
+	}
+}
+
+// nextPort returns the next ephemeral port, must be called with lock held.
+func (n *Namespace) nextPort() int {
+	n.port++
+	if n.port > 65535 {
+		n.port = 49152
+	}
+	return n.port
+}
+
+// listen creates a virtual listener on the address.
+func (n *Namespace) listen(network, address string) (net.Listener, error) {
+	family, err := namespaceNetwork(network)
+	if err != nil {
+		return nil, err
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if family == "tcp" {
+		host, port, splitErr := net.SplitHostPort(address)
+		if splitErr != nil {
+			return nil, splitErr
+		}
+		if host == "0.0.0.0" || host == "::" {
+			host = ""
+		}
+		if port == "0" {
+			for {
+				port = strconv.Itoa(n.nextPort())
+				if _, ok := n.listeners[family+" "+net.JoinHostPort(host, port)]; !ok {
+					break
+				}
+			}
+		}
+		address = net.JoinHostPort(host, port)
+	}
+
+	key := family + " " + address
+	if _, ok := n.listeners[key]; ok {
+		return nil, syscall.EADDRINUSE
+	}
+
+	listener := &virtualListener{
+		namespace: n,
+		key:       key,
+		addr:      &genericAddr{network: network, address: address},
+		conns:     make(chan net.Conn, namespaceBacklog),
+		closed:    make(chan struct{}),
+		deadline:  make(chan struct{}),
+	}
+	n.listeners[key] = listener
+
+	return listener, nil
+}
+
+// lookup returns the listener that accepts connections to the address.
+func (n *Namespace) lookup(network, address string) (*virtualListener, bool) {
+	family, err := namespaceNetwork(network)
+	if err != nil {
+		return nil, false
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if listener, ok := n.listeners[family+" "+address]; ok {
+		return listener, true
+	}
+
+	if family != "tcp" {
+		return nil, false
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, false
+	}
+
+	listener, ok := n.listeners[family+" "+net.JoinHostPort("", port)]
+	return listener, ok
+}
+
+// dial connects to the virtual listener on the address, returns [syscall.ECONNREFUSED] if there is no such listener.
+func (n *Namespace) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	listener, ok := n.lookup(network, address)
+	if !ok {
+		return nil, syscall.ECONNREFUSED
+	}
+
+	clientAddr := &genericAddr{network: network, address: "memory"}
+	if family, _ := namespaceNetwork(network); family == "tcp" {
+		n.lock.Lock()
+		clientAddr.address = net.JoinHostPort("127.0.0.1", strconv.Itoa(n.nextPort()))
+		n.lock.Unlock()
+	}
+
+	remoteAddr := &genericAddr{network: network, address: address}
+	clientConn, serverConn := net.Pipe()
+
+	select {
+	case listener.conns <- &pipeConn{Conn: serverConn, local: remoteAddr, remote: clientAddr}:
+	case <-listener.closed:
+		return nil, syscall.ECONNREFUSED
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-listener.closed:
+		// Listener could be closed while connection was queued
+		_ = serverConn.Close()
+		return nil, syscall.ECONNREFUSED
+	default:
+	}
+
+	return &pipeConn{Conn: clientConn, local: clientAddr, remote: remoteAddr}, nil
+}
+
+// virtualListener is a listener in the namespace.
+type virtualListener struct {
+	namespace *Namespace
+	key       string
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	deadline     chan struct{}
+	timer        *time.Timer
+	deadlineLock sync.Mutex
+}
+
+func (l *virtualListener) Accept() (net.Conn, error) {
+	l.deadlineLock.Lock()
+	deadline := l.deadline
+	l.deadlineLock.Unlock()
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, l.opError(net.ErrClosed)
+	case <-deadline:
+		return nil, l.opError(os.ErrDeadlineExceeded)
+	}
+}
+
+func (l *virtualListener) Close() error {
+	closed := false
+	l.closeOnce.Do(func() {
+		closed = true
+		close(l.closed)
+
+		l.namespace.lock.Lock()
+		delete(l.namespace.listeners, l.key)
+		l.namespace.lock.Unlock()
+	})
+	if !closed {
+		return l.opError(net.ErrClosed)
+	}
+
+	for {
+		select {
+		case conn := <-l.conns:
+			_ = conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (l *virtualListener) Addr() net.Addr {
+	return l.addr
+}
+
+// SetDeadline sets the deadline of accept, zero value means no deadline.
+func (l *virtualListener) SetDeadline(t time.Time) error {
+	l.deadlineLock.Lock()
+	defer l.deadlineLock.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	select {
+	case <-l.deadline:
+		l.deadline = make(chan struct{})
+	default:
+	}
+
+	if t.IsZero() {
+		return nil
+	}
+
+	deadline := l.deadline
+	timeout := time.Until(t)
+	if timeout <= 0 {
+		close(deadline)
+		return nil
+	}
+
+	l.timer = time.AfterFunc(timeout, func() {
+		l.deadlineLock.Lock()
+		defer l.deadlineLock.Unlock()
+		select {
+		case <-deadline:
+		default:
+			close(deadline)
+		}
+	})
+
+	return nil
+}
+
+// opError wraps the error of accept.
+func (l *virtualListener) opError(err error) error {
+	return &net.OpError{Op: "accept", Net: l.addr.Network(), Addr: l.addr, Err: err}
+}
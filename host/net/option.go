@@ -0,0 +1,234 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// Connection options, must be kept in sync with the plugin module.
+const (
+	connOptionNoDelay         = 0
+	connOptionKeepAlive       = 1
+	connOptionKeepAlivePeriod = 2
+	connOptionLinger          = 3
+	connOptionReadBuffer      = 4
+	connOptionWriteBuffer     = 5
+)
+
+// Connection option names used in [ConnOptionConfig].
+const (
+	ConnOptionNoDelay         = "noDelay"
+	ConnOptionKeepAlive       = "keepAlive"
+	ConnOptionKeepAlivePeriod = "keepAlivePeriod"
+	ConnOptionLinger          = "linger"
+	ConnOptionReadBuffer      = "readBuffer"
+	ConnOptionWriteBuffer     = "writeBuffer"
+	ConnOptionShutdown        = "shutdown"
+)
+
+// connOptionNames maps connection options to their names.
+var connOptionNames = map[int32]string{
+	connOptionNoDelay:         ConnOptionNoDelay,
+	connOptionKeepAlive:       ConnOptionKeepAlive,
+	connOptionKeepAlivePeriod: ConnOptionKeepAlivePeriod,
+	connOptionLinger:          ConnOptionLinger,
+	connOptionReadBuffer:      ConnOptionReadBuffer,
+	connOptionWriteBuffer:     ConnOptionWriteBuffer,
+}
+
+// Shutdown modes.
+const (
+	shutdownModeRead  = 1
+	shutdownModeWrite = 2
+)
+
+// ConnOptionConfig configures [ConnSetOption] and [ConnShutdown].
+type ConnOptionConfig struct {
+	// OptionsAllowed configures the allowed connection options: "noDelay", "keepAlive", "keepAlivePeriod", "linger",
+	// "readBuffer", "writeBuffer" and "shutdown" (half-close). Defaults to none.
+	OptionsAllowed []string
+	// OptionsAllowAll allows to set all connection options. Defaults to false.
+	OptionsAllowAll bool
+}
+
+// Validate returns an error if any of allowed options is unknown.
+func (cfg ConnOptionConfig) Validate() error {
+	for _, name := range cfg.OptionsAllowed {
+		known := name == ConnOptionShutdown
+		for _, optionName := range connOptionNames {
+			known = known || optionName == name
+		}
+
+		if !known {
+			return fmt.Errorf("unknown connection option: %q", name)
+		}
+	}
+	return nil
+}
+
+// allowed reports whether the option is allowed.
+func (cfg ConnOptionConfig) allowed(name string) bool {
+	return cfg.OptionsAllowAll || slices.Contains(cfg.OptionsAllowed, name)
+}
+
+// ConnSetOption sets the socket option of a connection if allowed, see [net.TCPConn] for options.
+// Value is passed as i64: 0 or 1 for boolean options, nanoseconds for keep alive period, seconds for linger and bytes
+// for buffer sizes. Options are set on the underlying host socket, connections without one (virtual or replayed) and
+// connections that don't support the option return invalid argument error.
+func ConnSetOption(cfg ConnOptionConfig) extism.HostFunction {
+	return internal.NewHostFunction("net.conn.setOption",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			connectionID := extism.DecodeI32(stack[0])
+
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := setOption(cfg, conn, extism.DecodeI32(stack[1]), int64(stack[2])); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{
+			extism.ValueTypeI32 /* connectionID */, extism.ValueTypeI32 /* option */, extism.ValueTypeI64, /* value */
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// setOption sets the option of the connection.
+func setOption(cfg ConnOptionConfig, conn net.Conn, option int32, value int64) error {
+	name, ok := connOptionNames[option]
+	if !ok {
+		return fmt.Errorf("%w: unknown connection option: %d", internal.ErrInvalidArgument, option)
+	}
+
+	if !cfg.allowed(name) {
+		return fmt.Errorf("%w: connection option not allowed: %s", internal.ErrPermissionDenied, name)
+	}
+
+	if value < 0 && option != connOptionLinger {
+		return fmt.Errorf("%w: negative connection option value: %d", internal.ErrInvalidArgument, value)
+	}
+
+	var err error
+	switch option {
+	case connOptionNoDelay:
+		ok, err = withConn(conn, func(c interface{ SetNoDelay(bool) error }) error {
+			return c.SetNoDelay(value != 0)
+		})
+	case connOptionKeepAlive:
+		ok, err = withConn(conn, func(c interface{ SetKeepAlive(bool) error }) error {
+			return c.SetKeepAlive(value != 0)
+		})
+	case connOptionKeepAlivePeriod:
+		ok, err = withConn(conn, func(c interface{ SetKeepAlivePeriod(time.Duration) error }) error {
+			return c.SetKeepAlivePeriod(time.Duration(value))
+		})
+	case connOptionLinger:
+		ok, err = withConn(conn, func(c interface{ SetLinger(int) error }) error {
+			return c.SetLinger(int(max(value, -1)))
+		})
+	case connOptionReadBuffer:
+		ok, err = withConn(conn, func(c interface{ SetReadBuffer(int) error }) error {
+			return c.SetReadBuffer(int(value))
+		})
+	case connOptionWriteBuffer:
+		ok, err = withConn(conn, func(c interface{ SetWriteBuffer(int) error }) error {
+			return c.SetWriteBuffer(int(value))
+		})
+	}
+	if !ok {
+		return fmt.Errorf("%w: connection option not supported: %s", internal.ErrInvalidArgument, name)
+	}
+
+	return err
+}
+
+// ConnShutdown shuts down the reading or writing side of a connection if "shutdown" option is allowed, see
+// [net.TCPConn.CloseRead] and [net.TCPConn.CloseWrite]. Shutting down writing side of TLS connection sends close notify
+// alert, connections that don't support half-close return invalid argument error.
+func ConnShutdown(cfg ConnOptionConfig) extism.HostFunction {
+	return internal.NewHostFunction("net.conn.shutdown",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			connectionID := extism.DecodeI32(stack[0])
+
+			conn, ok := resources.Connections.Get(connectionID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := shutdown(cfg, conn, extism.DecodeI32(stack[1])); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* connectionID */, extism.ValueTypeI32 /* mode */},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// shutdown shuts down the reading or writing side of the connection based on mode.
+func shutdown(cfg ConnOptionConfig, conn net.Conn, mode int32) error {
+	if !cfg.allowed(ConnOptionShutdown) {
+		return fmt.Errorf("%w: connection option not allowed: %s", internal.ErrPermissionDenied, ConnOptionShutdown)
+	}
+
+	var ok bool
+	var err error
+	switch mode {
+	case shutdownModeRead:
+		ok, err = withConn(conn, func(c interface{ CloseRead() error }) error {
+			return c.CloseRead()
+		})
+	case shutdownModeWrite:
+		ok, err = withConn(conn, func(c interface{ CloseWrite() error }) error {
+			return c.CloseWrite()
+		})
+	default:
+		return fmt.Errorf("%w: unknown shutdown mode: %d", internal.ErrInvalidArgument, mode)
+	}
+	if !ok {
+		return fmt.Errorf("%w: half-close not supported by connection", internal.ErrInvalidArgument)
+	}
+
+	return err
+}
+
+// netConner is implemented by connections wrapping another connection, see [crypto/tls.Conn.NetConn].
+type netConner interface {
+	NetConn() net.Conn
+}
+
+// withConn calls fn with the first connection in the chain of wrapped connections that implements T, returns false
+// if there is no such connection.
+func withConn[T any](conn net.Conn, fn func(c T) error) (bool, error) {
+	for conn != nil {
+		if c, ok := conn.(T); ok {
+			return true, fn(c)
+		}
+
+		wrapper, ok := conn.(netConner)
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	return false, nil
+}
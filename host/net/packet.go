@@ -0,0 +1,270 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// ListenPacket creates a host function that calls [net.ListenPacket].
+// Local address is checked against the listen configuration, packet connections are not supported with namespace.
+func ListenPacket(cfg ListenConfig) extism.HostFunction {
+	listenPolicy := cfg.policy()
+	return internal.NewHostFunction("net.listenPacket",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			network, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			addr, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			if err = listenPolicy.check(ctx, network, addr); err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			if cfg.Namespace != nil {
+				// Namespace has no virtual packet connections, they would reach the host network
+				stack[0] = extism.EncodeI32(resources.Fail(fmt.Errorf(
+					"%w: packet connections not supported in namespace", internal.ErrPermissionDenied)))
+				return
+			}
+
+			quota := cfg.Quota.plugin(ctx)
+			if err = quota.acquire(); err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			listenConfig := &net.ListenConfig{}
+			packetConn, err := listenConfig.ListenPacket(ctx, network, addr)
+			if err != nil {
+				quota.release()
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+			packetConn = newCancelPacketConn(quota.trackPacketConn(packetConn))
+
+			packetConnID, ok := resources.PacketConnections.Add(packetConn)
+			if !ok {
+				_ = packetConn.Close()
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			stack[0] = extism.EncodeI32(packetConnID)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* network */, extism.ValueTypePTR /* address */},
+		[]extism.ValueType{extism.ValueTypeI32 /* packetConnectionID | errorCode */},
+	)
+}
+
+// PacketConnReadFrom reads a packet from a packet connection.
+// Address of the sender can be retrieved with [PacketConnReadFromAddress] once IO is finished, but before its result
+// is collected.
+func PacketConnReadFrom() extism.HostFunction {
+	return internal.NewHostFunction("net.packetConn.readFrom",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			packetConnID := extism.DecodeI32(stack[0])
+
+			packetConn, ok := resources.PacketConnections.Get(packetConnID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			length, err := internal.ReadLength(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			op := internal.NewReadOperation(stack[1], length)
+			handle, ok := resources.IOHandles.Add(op)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			cancel, restore := readInterrupt(packetConn)
+			op.Go(ctx, func() (int, error) {
+				n, addr, err := packetConn.ReadFrom(op.Buffer())
+				if addr != nil {
+					op.SetAddress(addr.String())
+				}
+				return n, err
+			}, cancel, restore)
+
+			stack[0] = extism.EncodeI32(handle)
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* packetConnectionID */, extism.ValueTypePTR /* readDestination */},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle | errorCode */},
+	)
+}
+
+// PacketConnReadFromAddress returns the sender address of the finished [PacketConnReadFrom] IO, address is kept by
+// IO handle, so it must be retrieved before the result of IO is collected. Zero pointer is returned if IO is pending or
+// failed.
+func PacketConnReadFromAddress() extism.HostFunction {
+	return internal.NewHostFunction("net.packetConn.readFromAddress",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			handle := extism.DecodeI32(stack[0])
+
+			resources := internal.PluginResources(ctx)
+			op, ok := resources.IOHandles.Get(handle)
+			if !ok {
+				resources.Fail(internal.ErrInvalidHandle)
+				stack[0] = 0
+				return
+			}
+
+			addr := op.Address()
+			if addr == "" {
+				stack[0] = 0
+				return
+			}
+
+			addrPtr, err := p.WriteString(addr)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = addrPtr
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle */},
+		[]extism.ValueType{extism.ValueTypePTR /* address */},
+	)
+}
+
+// PacketConnWriteTo writes a packet to the address using a packet connection.
+// Destination address is checked against the dial configuration.
+func PacketConnWriteTo(cfg DialConfig) extism.HostFunction {
+	dialer := NewDialer(cfg)
+	return internal.NewHostFunction("net.packetConn.writeTo",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			packetConnID := extism.DecodeI32(stack[0])
+
+			packetConn, ok := resources.PacketConnections.Get(packetConnID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			buffer, err := internal.CopyBytes(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			addr, err := internal.ReadString(p, stack[2])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			destination, err := dialer.resolvePacketAddr(ctx, packetConn, addr)
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			op := internal.NewIOOperation()
+			handle, ok := resources.IOHandles.Add(op)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			cancel, restore := writeInterrupt(packetConn)
+			op.Go(ctx, func() (int, error) {
+				return packetConn.WriteTo(buffer, destination)
+			}, cancel, restore)
+
+			stack[0] = extism.EncodeI32(handle)
+		},
+		[]extism.ValueType{
+			extism.ValueTypeI32 /* packetConnectionID */, extism.ValueTypePTR /* writeSource */, extism.ValueTypePTR, /* address */
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* ioHandle | errorCode */},
+	)
+}
+
+// PacketConnClose closes the packet connection.
+func PacketConnClose() extism.HostFunction {
+	return internal.NewHostFunction("net.packetConn.close",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+			packetConnID := extism.DecodeI32(stack[0])
+
+			packetConn, ok := resources.PacketConnections.Remove(packetConnID)
+			if !ok {
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrInvalidHandle))
+				return
+			}
+
+			var result int32
+			if err := packetConn.Close(); err != nil {
+				result = resources.Fail(err)
+			}
+
+			stack[0] = extism.EncodeI32(result)
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* packetConnectionID */},
+		[]extism.ValueType{extism.ValueTypeI32 /* errorCode */},
+	)
+}
+
+// resolvePacketAddr checks and resolves the address for the packet connection network.
+//
+// Address is rewritten the same way as for dial if there is a matching rewrite rule, rewritten address must belong to
+// the same network. Resolved IPs are checked against the IP policy and the first allowed one is used, Unix socket
+// paths are mapped to host paths unless rewritten. Packets are sent directly, proxy, cassette, handlers, namespace and
+// custom dial function are never used for them.
+func (d *Dialer) resolvePacketAddr(ctx context.Context, packetConn net.PacketConn, addr string) (net.Addr, error) {
+	network := packetConn.LocalAddr().Network()
+	if err := d.check(ctx, network, addr); err != nil {
+		return nil, err
+	}
+
+	targetNetwork, targetAddr, rewritten := d.rewrites.rewrite(network, addr)
+	if isUnixNetwork(network) != isUnixNetwork(targetNetwork) {
+		return nil, fmt.Errorf("%w: packet address rewritten to other network: %s", internal.ErrInvalidArgument,
+			targetNetwork)
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		addrPorts, err := d.resolve(ctx, network, targetAddr)
+		if err != nil {
+			return nil, err
+		}
+		return net.UDPAddrFromAddrPort(addrPorts[0]), nil
+	case "unixgram":
+		if rewritten {
+			return net.ResolveUnixAddr(network, targetAddr)
+		}
+		hostPath, err := d.unix.hostPath(addr)
+		if err != nil {
+			return nil, err
+		}
+		return net.ResolveUnixAddr(network, hostPath)
+	default:
+		return nil, fmt.Errorf("unsupported packet network: %s", network)
+	}
+}
@@ -0,0 +1,94 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// policy is a compiled network and address policy.
+type policy struct {
+	filter func(ctx context.Context, network, address string) (bool, error)
+
+	networksAllowed  []string
+	networksAllowAll bool
+
+	addressesAllowed  []AddressRule
+	addressesDenied   []AddressRule
+	addressesAllowAll bool
+
+	// err is set if any of address rules is invalid, in that case everything is denied
+	err error
+}
+
+// newPolicy compiles network and address policy.
+func newPolicy(
+	filter func(ctx context.Context, network, address string) (bool, error),
+	networksAllowed []string, networksAllowAll bool,
+	addressesAllowed, addressesDenied []string, addressesAllowAll bool,
+) *policy {
+	p := &policy{
+		filter:            filter,
+		networksAllowed:   networksAllowed,
+		networksAllowAll:  networksAllowAll,
+		addressesAllowAll: addressesAllowAll,
+	}
+
+	p.addressesAllowed, p.err = parseAddressRules(addressesAllowed)
+	if p.err != nil {
+		return p
+	}
+
+	p.addressesDenied, p.err = parseAddressRules(addressesDenied)
+	return p
+}
+
+// check returns an error if network or address is not allowed.
+func (p *policy) check(ctx context.Context, network, address string) error {
+	if p.filter != nil {
+		allowed, err := p.filter(ctx, network, address)
+		if err != nil {
+			return fmt.Errorf("network filter: %w", err)
+		}
+
+		if !allowed {
+			return fmt.Errorf("%w: network and/or address not allowed", internal.ErrPermissionDenied)
+		}
+
+		return nil
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if !p.networksAllowAll && !slices.Contains(p.networksAllowed, network) {
+		return fmt.Errorf("%w: network not allowed: %s", internal.ErrPermissionDenied, network)
+	}
+
+	if slices.ContainsFunc(p.addressesDenied, func(rule AddressRule) bool { return rule.Match(address) }) {
+		return fmt.Errorf("%w: address denied: %s", internal.ErrPermissionDenied, address)
+	}
+
+	if !p.addressesAllowAll &&
+		!slices.ContainsFunc(p.addressesAllowed, func(rule AddressRule) bool { return rule.Match(address) }) {
+		return fmt.Errorf("%w: address not allowed: %s", internal.ErrPermissionDenied, address)
+	}
+
+	return nil
+}
+
+// parseAddressRules parses all address rules.
+func parseAddressRules(rules []string) ([]AddressRule, error) {
+	parsedRules := make([]AddressRule, 0, len(rules))
+	for _, rule := range rules {
+		parsedRule, err := ParseAddressRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsedRules = append(parsedRules, parsedRule)
+	}
+	return parsedRules, nil
+}
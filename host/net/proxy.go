@@ -0,0 +1,354 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// ProxyConfig configures [Proxy].
+type ProxyConfig struct {
+	// URL of the upstream proxy, supported schemes are "socks5", "http" and "https", for example
+	// "socks5://proxy.internal:1080". Credentials can be passed as URL user info. "socks5h" (resolution by the proxy)
+	// is rejected, as destinations are always resolved and checked by the host.
+	URL string
+
+	// Username and Password configure proxy credentials, take priority over URL user info. SOCKS5 proxies use
+	// username/password authentication (RFC 1929), HTTP proxies use basic authentication.
+	Username string
+	Password string
+
+	// Bypass configures destinations that are dialed directly, see [AddressRule] for syntax. Rules are matched against
+	// both the dialed address and resolved IPs.
+	Bypass []string
+}
+
+// Proxy dials TCP connections through an upstream SOCKS5 or HTTP CONNECT proxy.
+//
+// Destinations are resolved and checked by the [Dialer] before dialing the proxy, so the proxy is always asked to
+// connect to vetted IPs. Only TCP networks are proxied, other networks are dialed directly.
+type Proxy struct {
+	scheme   string
+	address  string
+	username string
+	password string
+	auth     bool
+	bypass   []AddressRule
+	dialer   *net.Dialer
+
+	// err is set if the configuration is invalid, in that case all proxied dials fail
+	err error
+}
+
+// NewProxy creates a new proxy. Invalid configuration is reported on dial, so traffic never leaves the host directly
+// because of a misconfigured proxy.
+func NewProxy(cfg ProxyConfig) *Proxy {
+	p := &Proxy{
+		dialer: &net.Dialer{},
+	}
+
+	proxyURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		p.err = fmt.Errorf("invalid proxy URL: %w", err)
+		return p
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "http", "https":
+		p.scheme = proxyURL.Scheme
+	case "socks5h":
+		p.err = errors.New("invalid proxy URL: socks5h is not supported, destinations are resolved by the host, " +
+			"use socks5")
+		return p
+	default:
+		p.err = fmt.Errorf("invalid proxy URL: unsupported scheme: %q", proxyURL.Scheme)
+		return p
+	}
+
+	p.address = proxyURL.Host
+	if proxyURL.Port() == "" {
+		switch p.scheme {
+		case "socks5":
+			p.address = net.JoinHostPort(proxyURL.Hostname(), "1080")
+		case "http":
+			p.address = net.JoinHostPort(proxyURL.Hostname(), "80")
+		case "https":
+			p.address = net.JoinHostPort(proxyURL.Hostname(), "443")
+		}
+	}
+
+	if proxyURL.User != nil {
+		p.username = proxyURL.User.Username()
+		p.password, _ = proxyURL.User.Password()
+		p.auth = true
+	}
+	if cfg.Username != "" || cfg.Password != "" {
+		p.username, p.password = cfg.Username, cfg.Password
+		p.auth = true
+	}
+
+	p.bypass, p.err = parseAddressRules(cfg.Bypass)
+	return p
+}
+
+// use reports whether the connection to the address resolved to the IP should go through the proxy.
+func (p *Proxy) use(network, address string, addrPort netip.AddrPort) bool {
+	if p == nil {
+		return false
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return false
+	}
+
+	return !slices.ContainsFunc(p.bypass, func(rule AddressRule) bool {
+		return rule.Match(address) || rule.Match(addrPort.String())
+	})
+}
+
+// dial connects to the address through the proxy.
+func (p *Proxy) dial(ctx context.Context, address string) (net.Conn, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	conn, err := p.dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	if p.scheme == "https" {
+		host, _, _ := net.SplitHostPort(p.address)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+
+	handshakeConn := conn
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = handshakeConn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = handshakeConn.SetDeadline(aLongTimeAgo)
+	})
+
+	switch p.scheme {
+	case "socks5":
+		err = p.connectSOCKS5(conn, address)
+	default:
+		conn, err = p.connectHTTP(conn, address)
+	}
+
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// SOCKS5 protocol constants, see RFC 1928 and RFC 1929.
+const (
+	socks5Version          = 0x05
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+	socks5PasswordVersion  = 0x01
+	socks5CommandConnect   = 0x01
+	socks5AddrIPv4         = 0x01
+	socks5AddrDomain       = 0x03
+	socks5AddrIPv6         = 0x04
+)
+
+// socks5Errors maps SOCKS5 reply codes to errors.
+var socks5Errors = map[byte]error{
+	0x01: errors.New("general SOCKS server failure"),
+	0x02: fmt.Errorf("%w: connection not allowed by ruleset", internal.ErrPermissionDenied),
+	0x03: errors.New("network unreachable"),
+	0x04: errors.New("host unreachable"),
+	0x05: syscall.ECONNREFUSED,
+	0x06: errors.New("TTL expired"),
+	0x07: errors.New("command not supported"),
+	0x08: errors.New("address type not supported"),
+}
+
+// connectSOCKS5 asks SOCKS5 proxy to connect to the address.
+func (p *Proxy) connectSOCKS5(conn net.Conn, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %s", portStr)
+	}
+
+	method := byte(socks5AuthNone)
+	if p.auth {
+		method = socks5AuthPassword
+	}
+	if _, err = conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("proxy: unexpected SOCKS version: %d", reply[0])
+	}
+	if reply[1] == socks5AuthNoAcceptable || reply[1] != method {
+		return errors.New("proxy: no acceptable authentication methods")
+	}
+
+	if method == socks5AuthPassword {
+		if len(p.username) > 255 || len(p.password) > 255 {
+			return errors.New("proxy: username or password is too long")
+		}
+
+		auth := []byte{socks5PasswordVersion, byte(len(p.username))}
+		auth = append(auth, p.username...)
+		auth = append(auth, byte(len(p.password)))
+		auth = append(auth, p.password...)
+		if _, err = conn.Write(auth); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		if reply[1] != 0 {
+			return errors.New("proxy: authentication failed")
+		}
+	}
+
+	request := []byte{socks5Version, socks5CommandConnect, 0}
+	if ip, ipErr := netip.ParseAddr(host); ipErr == nil {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			request = append(request, socks5AddrIPv4)
+		} else {
+			request = append(request, socks5AddrIPv6)
+		}
+		request = append(request, ip.AsSlice()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("proxy: host name is too long")
+		}
+		request = append(request, socks5AddrDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err = conn.Write(request); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+	if header[1] != 0 {
+		replyErr, ok := socks5Errors[header[1]]
+		if !ok {
+			replyErr = fmt.Errorf("unknown SOCKS reply: %d", header[1])
+		}
+		return fmt.Errorf("proxy: %w", replyErr)
+	}
+
+	var boundLength int
+	switch header[3] {
+	case socks5AddrIPv4:
+		boundLength = net.IPv4len
+	case socks5AddrIPv6:
+		boundLength = net.IPv6len
+	case socks5AddrDomain:
+		if _, err = io.ReadFull(conn, header[:1]); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		boundLength = int(header[0])
+	default:
+		return fmt.Errorf("proxy: unexpected SOCKS address type: %d", header[3])
+	}
+
+	// Bound address and port are not used
+	if _, err = io.ReadFull(conn, make([]byte, boundLength+2)); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+
+	return nil
+}
+
+// connectHTTP asks HTTP proxy to connect to the address using CONNECT method.
+func (p *Proxy) connectHTTP(conn net.Conn, address string) (net.Conn, error) {
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.auth {
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.username + ":" + p.password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := request.Write(conn); err != nil {
+		return conn, fmt.Errorf("proxy: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return conn, fmt.Errorf("proxy: %w", err)
+	}
+	_ = response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusForbidden:
+		return conn, fmt.Errorf("proxy: %w: %s", internal.ErrPermissionDenied, response.Status)
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return conn, fmt.Errorf("proxy: unexpected status: %s", response.Status)
+	}
+
+	if reader.Buffered() == 0 {
+		return conn, nil
+	}
+
+	return &bufferedConn{
+		Conn:   conn,
+		reader: reader,
+	}, nil
+}
+
+// bufferedConn is a connection that reads data buffered during proxy handshake first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
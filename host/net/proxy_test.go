@@ -0,0 +1,368 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// proxyStandIn is an in-process proxy that serves the CONNECT handshake and then echoes data, so no real destination
+// is needed. Requested destinations are sent to the targets channel.
+type proxyStandIn struct {
+	listener net.Listener
+	targets  chan string
+}
+
+// newProxyStandIn starts a proxy stand-in that serves connections with the handshake function.
+func newProxyStandIn(t *testing.T, handshake func(conn net.Conn, reader *bufio.Reader) (string, bool)) *proxyStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	p := &proxyStandIn{
+		listener: listener,
+		targets:  make(chan string, 16),
+	}
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+				reader := bufio.NewReader(conn)
+				target, ok := handshake(conn, reader)
+				if !ok {
+					return
+				}
+				p.targets <- target
+
+				_, _ = io.Copy(conn, reader)
+			}()
+		}
+	}()
+
+	return p
+}
+
+// socks5StandIn returns SOCKS5 handshake that requires username/password authentication.
+func socks5StandIn(username, password string) func(conn net.Conn, reader *bufio.Reader) (string, bool) {
+	return func(conn net.Conn, reader *bufio.Reader) (string, bool) {
+		greeting := make([]byte, 2)
+		if _, err := io.ReadFull(reader, greeting); err != nil || greeting[0] != socks5Version {
+			return "", false
+		}
+		methods := make([]byte, greeting[1])
+		if _, err := io.ReadFull(reader, methods); err != nil {
+			return "", false
+		}
+		if !slices.Contains(methods, socks5AuthPassword) {
+			_, _ = conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+			return "", false
+		}
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthPassword})
+
+		gotUsername, gotPassword, ok := readSOCKS5Credentials(reader)
+		if !ok {
+			return "", false
+		}
+		if gotUsername != username || gotPassword != password {
+			_, _ = conn.Write([]byte{socks5PasswordVersion, 1})
+			return "", false
+		}
+		_, _ = conn.Write([]byte{socks5PasswordVersion, 0})
+
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil || header[1] != socks5CommandConnect {
+			return "", false
+		}
+
+		var host string
+		switch header[3] {
+		case socks5AddrIPv4, socks5AddrIPv6:
+			ip := make([]byte, net.IPv4len)
+			if header[3] == socks5AddrIPv6 {
+				ip = make([]byte, net.IPv6len)
+			}
+			if _, err := io.ReadFull(reader, ip); err != nil {
+				return "", false
+			}
+			addr, _ := netip.AddrFromSlice(ip)
+			host = addr.String()
+		case socks5AddrDomain:
+			length, err := reader.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			name := make([]byte, length)
+			if _, err = io.ReadFull(reader, name); err != nil {
+				return "", false
+			}
+			host = string(name)
+		default:
+			return "", false
+		}
+
+		port := make([]byte, 2)
+		if _, err := io.ReadFull(reader, port); err != nil {
+			return "", false
+		}
+
+		reply := []byte{socks5Version, 0, 0, socks5AddrIPv4, 127, 0, 0, 1, 0, 0}
+		if _, err := conn.Write(reply); err != nil {
+			return "", false
+		}
+
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+	}
+}
+
+// readSOCKS5Credentials reads username/password authentication request.
+func readSOCKS5Credentials(reader *bufio.Reader) (string, string, bool) {
+	version, err := reader.ReadByte()
+	if err != nil || version != socks5PasswordVersion {
+		return "", "", false
+	}
+
+	read := func() (string, bool) {
+		length, readErr := reader.ReadByte()
+		if readErr != nil {
+			return "", false
+		}
+		value := make([]byte, length)
+		if _, readErr = io.ReadFull(reader, value); readErr != nil {
+			return "", false
+		}
+		return string(value), true
+	}
+
+	username, ok := read()
+	if !ok {
+		return "", "", false
+	}
+	password, ok := read()
+	return username, password, ok
+}
+
+// connectStandIn returns HTTP CONNECT handshake that requires basic authentication, early data is sent right after the
+// response, so it's buffered during the handshake.
+func connectStandIn(username, password, earlyData string) func(conn net.Conn, reader *bufio.Reader) (string, bool) {
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	return func(conn net.Conn, reader *bufio.Reader) (string, bool) {
+		request, err := http.ReadRequest(reader)
+		if err != nil || request.Method != http.MethodConnect {
+			return "", false
+		}
+
+		if request.Header.Get("Proxy-Authorization") != expected {
+			_, _ = io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\n\r\n")
+			return "", false
+		}
+
+		if _, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"+earlyData); err != nil {
+			return "", false
+		}
+		return request.Host, true
+	}
+}
+
+// proxyDialer returns dialer that allows everything and dials through the proxy.
+func proxyDialer(cfg ProxyConfig) *Dialer {
+	return NewDialer(DialConfig{
+		NetworksAllowAll:         true,
+		NetworkAddressesAllowAll: true,
+		Hosts:                    map[string][]string{"service.test": {"192.0.2.10"}},
+		HostsOnly:                true,
+		Proxy:                    NewProxy(cfg),
+	})
+}
+
+// echo writes the message to the connection and reads it back.
+func echo(t *testing.T, conn net.Conn, message string) string {
+	t.Helper()
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, message); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	response := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(response)
+}
+
+// target returns the destination requested from the proxy.
+func (p *proxyStandIn) target(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case target := <-p.targets:
+		return target
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy wasn't asked to connect")
+		return ""
+	}
+}
+
+func TestProxySOCKS5(t *testing.T) {
+	proxy := newProxyStandIn(t, socks5StandIn("user", "secret"))
+	dialer := proxyDialer(ProxyConfig{
+		URL: "socks5://user:secret@" + proxy.listener.Addr().String(),
+	})
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "service.test:8080")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Proxy is asked to connect to the vetted IP, not the host name
+	if target := proxy.target(t); target != "192.0.2.10:8080" {
+		t.Fatalf("unexpected proxy target: %s", target)
+	}
+
+	if response := echo(t, conn, "hello"); response != "hello" {
+		t.Fatalf("unexpected response: %q", response)
+	}
+}
+
+func TestProxySOCKS5AuthFailed(t *testing.T) {
+	proxy := newProxyStandIn(t, socks5StandIn("user", "secret"))
+	dialer := proxyDialer(ProxyConfig{
+		URL:      "socks5://user:secret@" + proxy.listener.Addr().String(),
+		Password: "wrong",
+	})
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "service.test:8080"); err == nil {
+		t.Fatal("expected authentication error")
+	}
+}
+
+func TestProxySOCKS5IPPolicy(t *testing.T) {
+	proxy := newProxyStandIn(t, socks5StandIn("user", "secret"))
+	dialer := NewDialer(DialConfig{
+		NetworksAllowAll:         true,
+		NetworkAddressesAllowAll: true,
+		NetworkIPsDenied:         []string{"192.0.2.0/24"},
+		Hosts:                    map[string][]string{"service.test": {"192.0.2.10"}},
+		HostsOnly:                true,
+		Proxy:                    NewProxy(ProxyConfig{URL: "socks5://user:secret@" + proxy.listener.Addr().String()}),
+	})
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "service.test:8080")
+	if !errors.Is(err, internal.ErrPermissionDenied) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+
+	select {
+	case target := <-proxy.targets:
+		t.Fatalf("proxy was asked to connect to denied IP: %s", target)
+	default:
+	}
+}
+
+func TestProxySOCKS5HRejected(t *testing.T) {
+	proxy := newProxyStandIn(t, socks5StandIn("user", "secret"))
+	dialer := proxyDialer(ProxyConfig{
+		URL: "socks5h://user:secret@" + proxy.listener.Addr().String(),
+	})
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "service.test:8080"); err == nil {
+		t.Fatal("expected socks5h to be rejected")
+	}
+}
+
+func TestProxyConnect(t *testing.T) {
+	proxy := newProxyStandIn(t, connectStandIn("user", "secret", "early"))
+	dialer := proxyDialer(ProxyConfig{
+		URL:      "http://" + proxy.listener.Addr().String(),
+		Username: "user",
+		Password: "secret",
+	})
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "service.test:443")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if target := proxy.target(t); target != "192.0.2.10:443" {
+		t.Fatalf("unexpected proxy target: %s", target)
+	}
+
+	// Data sent by the proxy right after the response is not lost
+	if response := echo(t, conn, "hello"); response != "early" {
+		t.Fatalf("unexpected early data: %q", response)
+	}
+	if response := echo(t, conn, "hello"); response != "hello" {
+		t.Fatalf("unexpected response: %q", response)
+	}
+}
+
+func TestProxyConnectForbidden(t *testing.T) {
+	proxy := newProxyStandIn(t, connectStandIn("user", "secret", ""))
+	dialer := proxyDialer(ProxyConfig{
+		URL: "http://user:wrong@" + proxy.listener.Addr().String(),
+	})
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "service.test:443")
+	if !errors.Is(err, internal.ErrPermissionDenied) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+}
+
+func TestProxyBypass(t *testing.T) {
+	proxy := newProxyStandIn(t, socks5StandIn("user", "secret"))
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = target.Close() }()
+	go func() {
+		conn, acceptErr := target.Accept()
+		if acceptErr == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	dialer := proxyDialer(ProxyConfig{
+		URL:    "socks5://user:secret@" + proxy.listener.Addr().String(),
+		Bypass: []string{"127.0.0.0/8"},
+	})
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = conn.Close()
+
+	select {
+	case proxied := <-proxy.targets:
+		t.Fatalf("bypassed destination was proxied: %s", proxied)
+	default:
+	}
+}
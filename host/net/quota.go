@@ -0,0 +1,560 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// QuotaConfig configures [Quota]. Zero values mean no limit.
+type QuotaConfig struct {
+	// MaxConnections limits the number of concurrently open connections, including accepted and packet connections.
+	MaxConnections int
+
+	// MaxBytesIn limits the total number of bytes read from all connections.
+	MaxBytesIn int64
+	// MaxBytesOut limits the total number of bytes written to all connections.
+	MaxBytesOut int64
+
+	// MaxConnBytesIn limits the number of bytes read from a single connection.
+	MaxConnBytesIn int64
+	// MaxConnBytesOut limits the number of bytes written to a single connection.
+	MaxConnBytesOut int64
+
+	// RateLimitIn limits the read bandwidth of all connections in bytes per second.
+	RateLimitIn int64
+	// RateLimitOut limits the write bandwidth of all connections in bytes per second.
+	RateLimitOut int64
+
+	// IdleTimeout closes connections that have no reads or writes for the duration.
+	IdleTimeout time.Duration
+	// MaxConnLifetime closes connections that are open for longer than the duration.
+	MaxConnLifetime time.Duration
+
+	// PerPlugin tracks limits separately for each plugin instance that calls host functions, otherwise limits are shared
+	// by all plugin instances.
+	PerPlugin bool
+}
+
+// Quota tracks network usage against [QuotaConfig], it's shared by all host functions that are configured with it.
+// Nil quota has no limits.
+type Quota struct {
+	cfg QuotaConfig
+
+	connections atomic.Int64
+
+	bytesIn  *budget
+	bytesOut *budget
+
+	rateIn  *rateLimiter
+	rateOut *rateLimiter
+}
+
+// NewQuota creates a new quota.
+func NewQuota(cfg QuotaConfig) *Quota {
+	return &Quota{
+		cfg:      cfg,
+		bytesIn:  newBudget(cfg.MaxBytesIn),
+		bytesOut: newBudget(cfg.MaxBytesOut),
+		rateIn:   newRateLimiter(cfg.RateLimitIn),
+		rateOut:  newRateLimiter(cfg.RateLimitOut),
+	}
+}
+
+// MaxConnections returns the limit of concurrently open connections, 0 means no limit.
+func (q *Quota) MaxConnections() int {
+	if q == nil {
+		return 0
+	}
+	return max(q.cfg.MaxConnections, 0)
+}
+
+// plugin returns the quota of the plugin that called the host function if limits are tracked per plugin, otherwise
+// returns the quota itself.
+func (q *Quota) plugin(ctx context.Context) *Quota {
+	if q == nil || !q.cfg.PerPlugin {
+		return q
+	}
+
+	return internal.PluginResources(ctx).Value(q, func() any {
+		cfg := q.cfg
+		cfg.PerPlugin = false
+		return NewQuota(cfg)
+	}).(*Quota)
+}
+
+// acquire reserves a connection, returns [ErrConnectionLimit] if limit is reached.
+func (q *Quota) acquire() error {
+	if q == nil || q.cfg.MaxConnections <= 0 {
+		return nil
+	}
+
+	if q.connections.Add(1) > int64(q.cfg.MaxConnections) {
+		q.connections.Add(-1)
+		return ErrConnectionLimit
+	}
+
+	return nil
+}
+
+// release releases a reserved connection.
+func (q *Quota) release() {
+	if q == nil || q.cfg.MaxConnections <= 0 {
+		return
+	}
+	q.connections.Add(-1)
+}
+
+// trackConn wraps the connection to enforce quota, connection must be already acquired.
+func (q *Quota) trackConn(conn net.Conn) net.Conn {
+	if q == nil {
+		return conn
+	}
+
+	qc := &quotaConn{
+		Conn:  conn,
+		quota: q,
+	}
+	qc.tracker = newConnTracker(q, conn.Close)
+	return qc
+}
+
+// wrapConn acquires a connection and wraps it to enforce quota, closes connection if limit is reached.
+func (q *Quota) wrapConn(conn net.Conn) (net.Conn, error) {
+	if err := q.acquire(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return q.trackConn(conn), nil
+}
+
+// trackPacketConn wraps the packet connection to enforce quota, connection must be already acquired.
+func (q *Quota) trackPacketConn(packetConn net.PacketConn) net.PacketConn {
+	if q == nil {
+		return packetConn
+	}
+
+	qc := &quotaPacketConn{
+		PacketConn: packetConn,
+		quota:      q,
+	}
+	qc.tracker = newConnTracker(q, packetConn.Close)
+	return qc
+}
+
+// connTracker tracks per connection usage, idle and lifetime timeouts.
+type connTracker struct {
+	quota *Quota
+	close func() error
+
+	bytesIn  *budget
+	bytesOut *budget
+
+	// ctx is canceled when the connection is closed, read and write deadlines mirror deadlines of the connection, so
+	// rate limiter waits are interrupted the same way as IO
+	ctx           context.Context
+	cancel        context.CancelFunc
+	readDeadline  *waitDeadline
+	writeDeadline *waitDeadline
+
+	idleTimer     *time.Timer
+	lifetimeTimer *time.Timer
+
+	closeReason atomic.Pointer[error]
+	closeOnce   sync.Once
+	closeErr    error
+}
+
+// newConnTracker creates a new connection tracker.
+func newConnTracker(q *Quota, closeConn func() error) *connTracker {
+	t := &connTracker{
+		quota:         q,
+		close:         closeConn,
+		bytesIn:       newBudget(q.cfg.MaxConnBytesIn),
+		bytesOut:      newBudget(q.cfg.MaxConnBytesOut),
+		readDeadline:  newWaitDeadline(),
+		writeDeadline: newWaitDeadline(),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	if q.cfg.IdleTimeout > 0 {
+		t.idleTimer = time.AfterFunc(q.cfg.IdleTimeout, func() {
+			t.closeWithReason(ErrIdleTimeout)
+		})
+	}
+
+	if q.cfg.MaxConnLifetime > 0 {
+		t.lifetimeTimer = time.AfterFunc(q.cfg.MaxConnLifetime, func() {
+			t.closeWithReason(ErrLifetimeExceeded)
+		})
+	}
+
+	return t
+}
+
+// touch resets idle timeout.
+func (t *connTracker) touch() {
+	if t.idleTimer != nil {
+		t.idleTimer.Reset(t.quota.cfg.IdleTimeout)
+	}
+}
+
+// reserve reserves up to n bytes from connection and total budgets, returns [ErrByteLimit] if any of them is exhausted.
+func (t *connTracker) reserve(connBudget, totalBudget *budget, n int) (int, error) {
+	n = connBudget.reserve(n)
+	if n == 0 {
+		return 0, ErrByteLimit
+	}
+
+	reserved := totalBudget.reserve(n)
+	connBudget.release(n - reserved)
+	if reserved == 0 {
+		return 0, ErrByteLimit
+	}
+
+	return reserved, nil
+}
+
+// commit releases unused bytes of the reservation and waits for the read rate limiter, data is already read, so
+// interrupted wait is not an error.
+func (t *connTracker) commit(connBudget, totalBudget *budget, limiter *rateLimiter, reserved, used int) {
+	connBudget.release(reserved - used)
+	totalBudget.release(reserved - used)
+	_ = limiter.wait(t.ctx, t.readDeadline, used)
+	t.touch()
+}
+
+// waitWrite waits for the write rate limiter, returns an error if the wait is interrupted by write deadline or close.
+func (t *connTracker) waitWrite(n int) error {
+	err := t.quota.rateOut.wait(t.ctx, t.writeDeadline, n)
+	if errors.Is(err, context.Canceled) {
+		err = net.ErrClosed
+	}
+	return t.err(err)
+}
+
+// setDeadlines sets deadlines used by rate limiter waits.
+func (t *connTracker) setDeadlines(read, write bool, deadline time.Time) {
+	if read {
+		t.readDeadline.set(deadline)
+	}
+	if write {
+		t.writeDeadline.set(deadline)
+	}
+}
+
+// err returns close reason if connection was closed because of the quota, otherwise the provided error.
+func (t *connTracker) err(err error) error {
+	if reason := t.closeReason.Load(); reason != nil && err != nil {
+		return *reason
+	}
+	return err
+}
+
+// closeWithReason closes the connection because of the quota.
+func (t *connTracker) closeWithReason(reason error) {
+	t.closeReason.CompareAndSwap(nil, &reason)
+	_ = t.closeConn()
+}
+
+// closeConn closes the connection once and releases it from the quota.
+func (t *connTracker) closeConn() error {
+	t.closeOnce.Do(func() {
+		if t.idleTimer != nil {
+			t.idleTimer.Stop()
+		}
+		if t.lifetimeTimer != nil {
+			t.lifetimeTimer.Stop()
+		}
+		t.cancel()
+		t.closeErr = t.close()
+		t.quota.release()
+	})
+	return t.closeErr
+}
+
+// quotaConn is a connection that enforces [Quota].
+type quotaConn struct {
+	net.Conn
+	quota   *Quota
+	tracker *connTracker
+}
+
+func (c *quotaConn) Read(b []byte) (int, error) {
+	reserved, err := c.tracker.reserve(c.tracker.bytesIn, c.quota.bytesIn, len(b))
+	if err != nil {
+		return 0, err
+	}
+	c.tracker.touch()
+
+	n, err := c.Conn.Read(b[:reserved])
+	c.tracker.commit(c.tracker.bytesIn, c.quota.bytesIn, c.quota.rateIn, reserved, n)
+	return n, c.tracker.err(err)
+}
+
+func (c *quotaConn) Write(b []byte) (int, error) {
+	reserved, err := c.tracker.reserve(c.tracker.bytesOut, c.quota.bytesOut, len(b))
+	if err != nil {
+		return 0, err
+	}
+	if err = c.tracker.waitWrite(reserved); err != nil {
+		c.tracker.commit(c.tracker.bytesOut, c.quota.bytesOut, nil, reserved, 0)
+		return 0, err
+	}
+	c.tracker.touch()
+
+	n, err := c.Conn.Write(b[:reserved])
+	c.tracker.commit(c.tracker.bytesOut, c.quota.bytesOut, nil, reserved, n)
+	if err == nil && reserved < len(b) {
+		err = ErrByteLimit
+	}
+	return n, c.tracker.err(err)
+}
+
+func (c *quotaConn) SetDeadline(t time.Time) error {
+	c.tracker.setDeadlines(true, true, t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *quotaConn) SetReadDeadline(t time.Time) error {
+	c.tracker.setDeadlines(true, false, t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *quotaConn) SetWriteDeadline(t time.Time) error {
+	c.tracker.setDeadlines(false, true, t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *quotaConn) Close() error {
+	return c.tracker.closeConn()
+}
+
+func (c *quotaConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// quotaPacketConn is a packet connection that enforces [Quota].
+type quotaPacketConn struct {
+	net.PacketConn
+	quota   *Quota
+	tracker *connTracker
+}
+
+func (c *quotaPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	reserved, err := c.tracker.reserve(c.tracker.bytesIn, c.quota.bytesIn, len(b))
+	if err != nil {
+		return 0, nil, err
+	}
+	c.tracker.touch()
+
+	n, addr, err := c.PacketConn.ReadFrom(b[:reserved])
+	c.tracker.commit(c.tracker.bytesIn, c.quota.bytesIn, c.quota.rateIn, reserved, n)
+	return n, addr, c.tracker.err(err)
+}
+
+func (c *quotaPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	reserved, err := c.tracker.reserve(c.tracker.bytesOut, c.quota.bytesOut, len(b))
+	if err != nil {
+		return 0, err
+	}
+	if reserved < len(b) {
+		// Packets can't be partially written
+		c.tracker.commit(c.tracker.bytesOut, c.quota.bytesOut, nil, reserved, 0)
+		return 0, ErrByteLimit
+	}
+	if err = c.tracker.waitWrite(reserved); err != nil {
+		c.tracker.commit(c.tracker.bytesOut, c.quota.bytesOut, nil, reserved, 0)
+		return 0, err
+	}
+	c.tracker.touch()
+
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.tracker.commit(c.tracker.bytesOut, c.quota.bytesOut, nil, reserved, n)
+	return n, c.tracker.err(err)
+}
+
+func (c *quotaPacketConn) SetDeadline(t time.Time) error {
+	c.tracker.setDeadlines(true, true, t)
+	return c.PacketConn.SetDeadline(t)
+}
+
+func (c *quotaPacketConn) SetReadDeadline(t time.Time) error {
+	c.tracker.setDeadlines(true, false, t)
+	return c.PacketConn.SetReadDeadline(t)
+}
+
+func (c *quotaPacketConn) SetWriteDeadline(t time.Time) error {
+	c.tracker.setDeadlines(false, true, t)
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+func (c *quotaPacketConn) Close() error {
+	return c.tracker.closeConn()
+}
+
+// budget is a byte budget, nil budget is unlimited.
+type budget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// newBudget creates a new budget, returns nil for no limit.
+func newBudget(limit int64) *budget {
+	if limit <= 0 {
+		return nil
+	}
+	return &budget{
+		limit: limit,
+	}
+}
+
+// reserve reserves up to n bytes, returns the number of reserved bytes.
+func (b *budget) reserve(n int) int {
+	if b == nil {
+		return n
+	}
+
+	for {
+		used := b.used.Load()
+		available := min(int64(n), b.limit-used)
+		if available <= 0 {
+			return 0
+		}
+
+		if b.used.CompareAndSwap(used, used+available) {
+			return int(available)
+		}
+	}
+}
+
+// release returns n unused bytes back to the budget.
+func (b *budget) release(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.used.Add(-int64(n))
+}
+
+// rateLimiter is a token bucket rate limiter with one second burst, nil rate limiter is unlimited.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// newRateLimiter creates a new rate limiter, returns nil for no limit.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens and waits until they are available. Wait is interrupted when the context is canceled or the
+// deadline expires, in that case tokens are returned and the error is returned.
+func (l *rateLimiter) wait(ctx context.Context, deadline *waitDeadline, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.lock.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	err := deadline.wait(ctx, timer.C)
+	if err != nil {
+		l.lock.Lock()
+		l.tokens += float64(n)
+		l.lock.Unlock()
+	}
+	return err
+}
+
+// waitDeadline is a deadline of rate limiter waits, changing it wakes up pending waits, so they observe the new
+// deadline.
+type waitDeadline struct {
+	deadline time.Time
+	changed  chan struct{}
+	lock     sync.Mutex
+}
+
+// newWaitDeadline creates a new wait deadline without a deadline.
+func newWaitDeadline() *waitDeadline {
+	return &waitDeadline{
+		changed: make(chan struct{}),
+	}
+}
+
+// set sets the deadline, zero time means no deadline.
+func (d *waitDeadline) set(deadline time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deadline = deadline
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// wait waits until done is ready, returns [os.ErrDeadlineExceeded] if the deadline expires first or context error if
+// the context is canceled first.
+func (d *waitDeadline) wait(ctx context.Context, done <-chan time.Time) error {
+	for {
+		changed, err := d.waitOnce(ctx, done)
+		if !changed {
+			return err
+		}
+	}
+}
+
+// waitOnce waits until done is ready, the deadline expires, the context is canceled or the deadline is changed,
+// returns true in the last case.
+func (d *waitDeadline) waitOnce(ctx context.Context, done <-chan time.Time) (bool, error) {
+	d.lock.Lock()
+	deadline, changed := d.deadline, d.changed
+	d.lock.Unlock()
+
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return false, os.ErrDeadlineExceeded
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-done:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-expired:
+		return false, os.ErrDeadlineExceeded
+	case <-changed:
+		return true, nil
+	}
+}
@@ -2,36 +2,352 @@ package net
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
-	"strings"
+	"slices"
 
 	extism "github.com/extism/go-sdk"
 
 	"github.com/mymmrac/wape/internal"
 )
 
+// ResolverConfig configures resolver host functions.
+type ResolverConfig struct {
+	// ResolveFilter allows to create custom filtering for resolved names.
+	// Takes priority over names configuration if present. Defaults to nil.
+	ResolveFilter func(ctx context.Context, name string) (bool, error)
+
+	// ResolveNamesAllowed configures the allowed names to resolve, see [AddressRule] for syntax, ports are ignored.
+	// Defaults to none.
+	ResolveNamesAllowed []string
+	// ResolveNamesAllowAll allows to resolve all names. Defaults to false.
+	ResolveNamesAllowAll bool
+
+	// Hosts configures static host names to IPs mapping, takes priority over DNS. Defaults to none.
+	Hosts map[string][]string
+	// HostsFile configures static hosts from a file in hosts file format merged with Hosts, see [ReadHostsFile]. If the
+	// file can't be read, all lookups and dials fail. Defaults to none.
+	HostsFile string
+	// HostsOnly disables DNS, only static hosts and IPs are resolved. Defaults to false.
+	HostsOnly bool
+}
+
+// resolvePolicy is a compiled resolve policy.
+type resolvePolicy struct {
+	filter        func(ctx context.Context, name string) (bool, error)
+	namesAllowed  []AddressRule
+	namesAllowAll bool
+
+	// err is set if any of name rules is invalid, in that case everything is denied
+	err error
+}
+
+// policy returns compiled resolve policy.
+func (cfg ResolverConfig) policy() *resolvePolicy {
+	p := &resolvePolicy{
+		filter:        cfg.ResolveFilter,
+		namesAllowAll: cfg.ResolveNamesAllowAll,
+	}
+	p.namesAllowed, p.err = parseAddressRules(cfg.ResolveNamesAllowed)
+	return p
+}
+
+// Validate returns an error if any of name rules is invalid or static hosts can't be loaded, lookup host functions
+// created with invalid configuration fail every lookup.
+func (cfg ResolverConfig) Validate() error {
+	return errors.Join(cfg.policy().err, newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly).err)
+}
+
+// check returns an error if name is not allowed to be resolved.
+func (p *resolvePolicy) check(ctx context.Context, name string) error {
+	if p.filter != nil {
+		allowed, err := p.filter(ctx, name)
+		if err != nil {
+			return fmt.Errorf("resolve filter: %w", err)
+		}
+
+		if !allowed {
+			return fmt.Errorf("%w: name not allowed: %s", internal.ErrPermissionDenied, name)
+		}
+
+		return nil
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if !p.namesAllowAll &&
+		!slices.ContainsFunc(p.namesAllowed, func(rule AddressRule) bool { return rule.matchHost(name) }) {
+		return fmt.Errorf("%w: name not allowed: %s", internal.ErrPermissionDenied, name)
+	}
+
+	return nil
+}
+
+// SRVResult is a result of [net.Resolver.LookupSRV].
+type SRVResult struct {
+	CNAME string     `json:"cname"`
+	Addrs []*net.SRV `json:"addrs"`
+}
+
 // LookupHost creates a host function that calls [net.Resolver.LookupHost].
-func LookupHost() extism.HostFunction {
+// Returns JSON encoded list of addresses.
+func LookupHost(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
 	return internal.NewHostFunction("net.resolver.lookupHost",
 		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
-			host, err := p.ReadString(stack[0])
+			resources := internal.PluginResources(ctx)
+
+			host, err := internal.ReadString(p, stack[0])
 			if err != nil {
-				panic(err)
+				resources.Fail(err)
+				stack[0] = 0
+				return
 			}
 
-			addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+			if err = resolvePolicy.check(ctx, host); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			addresses, err := resolver.lookupHost(ctx, host)
 			if err != nil {
-				panic(err)
+				resources.Fail(err)
+				stack[0] = 0
+				return
 			}
 
-			addressesPtr, err := p.WriteString(strings.Join(addresses, ","))
+			stack[0] = writeJSON(p, resources, addresses)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* host */},
+		[]extism.ValueType{extism.ValueTypePTR /* addresses */},
+	)
+}
+
+// LookupIP creates a host function that calls [net.Resolver.LookupIP].
+// Returns JSON encoded list of IPs.
+func LookupIP(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
+	return internal.NewHostFunction("net.resolver.lookupIP",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			network, err := internal.ReadString(p, stack[0])
 			if err != nil {
-				panic(err)
+				resources.Fail(err)
+				stack[0] = 0
+				return
 			}
 
-			stack[0] = addressesPtr
+			host, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = resolvePolicy.check(ctx, host); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			ips, err := resolver.lookupIP(ctx, network, host)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeJSON(p, resources, ips)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* network */, extism.ValueTypePTR /* host */},
+		[]extism.ValueType{extism.ValueTypePTR /* ips */},
+	)
+}
+
+// LookupSRV creates a host function that calls [net.Resolver.LookupSRV].
+// Returns JSON encoded [SRVResult].
+func LookupSRV(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
+	return internal.NewHostFunction("net.resolver.lookupSRV",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			service, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			proto, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			name, err := internal.ReadString(p, stack[2])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = resolvePolicy.check(ctx, name); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			cname, addrs, err := resolver.lookupSRV(ctx, service, proto, name)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeJSON(p, resources, SRVResult{
+				CNAME: cname,
+				Addrs: addrs,
+			})
+		},
+		[]extism.ValueType{
+			extism.ValueTypePTR /* service */, extism.ValueTypePTR /* proto */, extism.ValueTypePTR, /* name */
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* result */},
+	)
+}
+
+// LookupTXT creates a host function that calls [net.Resolver.LookupTXT].
+// Returns JSON encoded list of records.
+func LookupTXT(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
+	return internal.NewHostFunction("net.resolver.lookupTXT",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			name, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = resolvePolicy.check(ctx, name); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			records, err := resolver.lookupTXT(ctx, name)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeJSON(p, resources, records)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* name */},
+		[]extism.ValueType{extism.ValueTypePTR /* records */},
+	)
+}
+
+// LookupMX creates a host function that calls [net.Resolver.LookupMX].
+// Returns JSON encoded list of [net.MX] records.
+func LookupMX(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
+	return internal.NewHostFunction("net.resolver.lookupMX",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			name, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = resolvePolicy.check(ctx, name); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			records, err := resolver.lookupMX(ctx, name)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeJSON(p, resources, records)
+		},
+		[]extism.ValueType{extism.ValueTypePTR /* name */},
+		[]extism.ValueType{extism.ValueTypePTR /* records */},
+	)
+}
+
+// LookupCNAME creates a host function that calls [net.Resolver.LookupCNAME].
+// Returns JSON encoded canonical name.
+func LookupCNAME(cfg ResolverConfig) extism.HostFunction {
+	resolvePolicy := cfg.policy()
+	resolver := newResolver(cfg.Hosts, cfg.HostsFile, cfg.HostsOnly)
+	return internal.NewHostFunction("net.resolver.lookupCNAME",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			host, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			if err = resolvePolicy.check(ctx, host); err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			cname, err := resolver.lookupCNAME(ctx, host)
+			if err != nil {
+				resources.Fail(err)
+				stack[0] = 0
+				return
+			}
+
+			stack[0] = writeJSON(p, resources, cname)
 		},
 		[]extism.ValueType{extism.ValueTypePTR /* host */},
-		[]extism.ValueType{extism.ValueTypePTR /* addresses | errorCode */},
+		[]extism.ValueType{extism.ValueTypePTR /* cname */},
 	)
 }
+
+// writeJSON writes JSON encoded value into plugin memory, returns zero pointer on error.
+func writeJSON(p *extism.CurrentPlugin, resources *internal.Resources, v any) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		resources.Fail(err)
+		return 0
+	}
+
+	ptr, err := p.WriteBytes(data)
+	if err != nil {
+		resources.Fail(err)
+		return 0
+	}
+
+	return ptr
+}
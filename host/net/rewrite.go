@@ -0,0 +1,99 @@
+package net
+
+import (
+	"net"
+	"strings"
+)
+
+// rewriteTarget is a target of the rewrite rule.
+type rewriteTarget struct {
+	network string
+	address string
+}
+
+// rewrites is a compiled set of address rewrite rules.
+type rewrites struct {
+	exact map[string]rewriteTarget
+	hosts map[string]rewriteTarget
+}
+
+// newRewrites compiles address rewrite rules, returns nil if there are no rules.
+//
+// Rules map guest addresses to targets. Guest address with port ("localhost:5432") is matched exactly, guest address
+// without port ("api") matches the host with any port. Target can be prefixed with a network ("unix:/run/api.sock",
+// "tcp4:10.0.0.1:80") to change the network, target without port keeps the guest port.
+func newRewrites(rules map[string]string) *rewrites {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	r := &rewrites{
+		exact: make(map[string]rewriteTarget),
+		hosts: make(map[string]rewriteTarget),
+	}
+
+	for from, to := range rules {
+		var target rewriteTarget
+		if network, address, ok := strings.Cut(to, ":"); ok && isRewriteNetwork(network) {
+			target = rewriteTarget{network: network, address: address}
+		} else {
+			target = rewriteTarget{address: to}
+		}
+
+		if _, _, err := net.SplitHostPort(from); err == nil {
+			r.exact[normalizeRewriteAddress(from)] = target
+		} else {
+			r.hosts[normalizeHost(from)] = target
+		}
+	}
+
+	return r
+}
+
+// isRewriteNetwork reports whether the network can be used as a rewrite target prefix.
+func isRewriteNetwork(network string) bool {
+	return isIPNetwork(network) || isUnixNetwork(network)
+}
+
+// normalizeRewriteAddress returns address with normalized host.
+func normalizeRewriteAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return net.JoinHostPort(normalizeHost(host), port)
+}
+
+// rewrite returns the target network and address for the address, returns false if there is no matching rule.
+func (r *rewrites) rewrite(network, address string) (string, string, bool) {
+	if r == nil {
+		return network, address, false
+	}
+
+	target, ok := r.exact[normalizeRewriteAddress(address)]
+	if !ok {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return network, address, false
+		}
+
+		target, ok = r.hosts[normalizeHost(host)]
+		if !ok {
+			return network, address, false
+		}
+	}
+
+	if !isUnixNetwork(target.network) {
+		if _, port, err := net.SplitHostPort(address); err == nil {
+			if _, _, err = net.SplitHostPort(target.address); err != nil {
+				target.address = net.JoinHostPort(target.address, port)
+			}
+		}
+	}
+
+	if target.network != "" {
+		network = target.network
+	}
+
+	return network, target.address, true
+}
@@ -0,0 +1,216 @@
+package net
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+
+	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// TLSConfig configures [DialTLS].
+type TLSConfig struct {
+	// Config is the base TLS configuration, it's cloned for each connection and other configurations override it.
+	// Defaults to nil.
+	Config *tls.Config
+
+	// RootCAs configures root certificate authorities used to verify servers. Defaults to the host root CA set.
+	RootCAs *x509.CertPool
+	// RootCAsFile configures root certificate authorities from a PEM file, takes priority over RootCAs. The file is
+	// read for each connection, connections fail if it can't be read or has no certificates. Defaults to none.
+	RootCAsFile string
+
+	// ClientCertificates configures client certificates presented to servers that request them (mutual TLS),
+	// certificates are never exposed to the guest. Defaults to none.
+	ClientCertificates []tls.Certificate
+	// ClientCertFile and ClientKeyFile configure client certificate and its private key from PEM files, take priority
+	// over ClientCertificates. Files are read for each connection, connections fail if only one of them is set or they
+	// can't be loaded. Defaults to none.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// ServerNames pins server names used for SNI and certificate verification per destination. Keys are address rules
+	// (see [AddressRule]) matched against addresses dialed by the guest before rewrites, the longest matching rule is
+	// used. Defaults to the host of the dialed address, the guest can't choose it.
+	ServerNames map[string]string
+}
+
+// ClientConfig returns TLS client configuration for the address dialed by the guest, target is the address actually
+// dialed after rewrites. Returns an error if server name rules are invalid or certificate files can't be loaded.
+func (cfg TLSConfig) ClientConfig(address, target string) (*tls.Config, error) {
+	serverName, err := cfg.serverName(address)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs, err := cfg.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	clientCertificates, err := cfg.clientCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.Config != nil {
+		tlsConfig = cfg.Config.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+
+	if rootCAs != nil {
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if len(clientCertificates) > 0 {
+		tlsConfig.Certificates = clientCertificates
+	}
+
+	switch {
+	case serverName != "":
+		tlsConfig.ServerName = serverName
+	case tlsConfig.ServerName == "":
+		host, _, err := net.SplitHostPort(target)
+		if err != nil {
+			host = target
+		}
+		tlsConfig.ServerName = host
+	}
+
+	return tlsConfig, nil
+}
+
+// Validate returns an error if server name rules are invalid or certificate files can't be loaded, TLS dials with
+// invalid configuration fail.
+func (cfg TLSConfig) Validate() error {
+	for pattern := range cfg.ServerNames {
+		if _, err := ParseAddressRule(pattern); err != nil {
+			return fmt.Errorf("invalid TLS server name: %w", err)
+		}
+	}
+
+	if _, err := cfg.rootCAs(); err != nil {
+		return err
+	}
+
+	_, err := cfg.clientCertificates()
+	return err
+}
+
+// rootCAs returns root certificate authorities loaded from the file if configured, otherwise the configured ones.
+func (cfg TLSConfig) rootCAs() (*x509.CertPool, error) {
+	if cfg.RootCAsFile == "" {
+		return cfg.RootCAs, nil
+	}
+
+	data, err := os.ReadFile(cfg.RootCAsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS root CAs file: %w", err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in TLS root CAs file: %s", cfg.RootCAsFile)
+	}
+
+	return rootCAs, nil
+}
+
+// clientCertificates returns client certificate loaded from files if configured, otherwise the configured ones.
+func (cfg TLSConfig) clientCertificates() ([]tls.Certificate, error) {
+	if cfg.ClientCertFile == "" && cfg.ClientKeyFile == "" {
+		return cfg.ClientCertificates, nil
+	}
+	if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+		return nil, errors.New("TLS client certificate requires both certificate and key files")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS client certificate: %w", err)
+	}
+
+	return []tls.Certificate{cert}, nil
+}
+
+// serverName returns the server name pinned for the address by the longest matching rule, returns empty string if
+// there is no matching rule.
+func (cfg TLSConfig) serverName(address string) (string, error) {
+	if len(cfg.ServerNames) == 0 {
+		return "", nil
+	}
+
+	patterns := slices.SortedFunc(maps.Keys(cfg.ServerNames), func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+	})
+
+	for _, pattern := range patterns {
+		rule, err := ParseAddressRule(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid TLS server name: %w", err)
+		}
+
+		if rule.Match(address) {
+			return cfg.ServerNames[pattern], nil
+		}
+	}
+
+	return "", nil
+}
+
+// DialTLS creates a host function that calls [Dialer.DialTLSContext].
+// Guest gets a plaintext stream that is read and written the same way as connections created by [Dial]. Timeout is
+// passed the same way as for [Dial] and covers TLS handshake.
+func DialTLS(cfg DialConfig, tlsCfg TLSConfig) extism.HostFunction {
+	dialer := NewDialer(cfg)
+	return internal.NewHostFunction("net.dialTLS",
+		func(ctx context.Context, p *extism.CurrentPlugin, stack []uint64) {
+			resources := internal.PluginResources(ctx)
+
+			network, err := internal.ReadString(p, stack[0])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			addr, err := internal.ReadString(p, stack[1])
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			ctx, cancel := dialContext(ctx, int64(stack[2]))
+			defer cancel()
+
+			conn, err := dialer.DialTLSContext(ctx, network, addr, tlsCfg)
+			if err != nil {
+				stack[0] = extism.EncodeI32(resources.Fail(err))
+				return
+			}
+
+			connID, ok := resources.Connections.Add(newCancelConn(conn))
+			if !ok {
+				_ = conn.Close()
+				stack[0] = extism.EncodeI32(resources.Fail(internal.ErrNoHandles))
+				return
+			}
+
+			stack[0] = extism.EncodeI32(connID)
+		},
+		[]extism.ValueType{
+			extism.ValueTypePTR /* network */, extism.ValueTypePTR /* address */, extism.ValueTypeI64, /* timeout */
+		},
+		[]extism.ValueType{extism.ValueTypeI32 /* connectionID | errorCode */},
+	)
+}
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mymmrac/wape/internal"
+)
+
+// unixSockets maps guest Unix socket paths to host socket paths.
+type unixSockets map[string]string
+
+// isUnixNetwork reports whether the network is a Unix domain socket network.
+func isUnixNetwork(network string) bool {
+	switch network {
+	case "unix", "unixgram", "unixpacket":
+		return true
+	default:
+		return false
+	}
+}
+
+// hostPath returns the host socket path of the guest path. Guest paths ending with "/" map all sockets under them,
+// exact paths take priority over such prefixes and the longest prefix wins. All paths are allowed if mapping is nil.
+func (s unixSockets) hostPath(guestPath string) (string, error) {
+	if s == nil {
+		return guestPath, nil
+	}
+
+	if !strings.HasPrefix(guestPath, "@") {
+		guestPath = path.Clean(guestPath)
+	}
+
+	if hostPath, ok := s[guestPath]; ok {
+		return hostPath, nil
+	}
+
+	var guestPrefix string
+	for prefix := range s {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(guestPath, prefix) && len(prefix) > len(guestPrefix) {
+			guestPrefix = prefix
+		}
+	}
+	if guestPrefix == "" {
+		return "", fmt.Errorf("%w: unix socket not mapped: %s", internal.ErrPermissionDenied, guestPath)
+	}
+
+	return path.Join(s[guestPrefix], strings.TrimPrefix(guestPath, guestPrefix)), nil
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Error codes returned to the guest, must be kept in sync with the plugin module.
+const (
+	ErrCodeUnknown           int32 = -1
+	ErrCodeEOF               int32 = -2
+	ErrCodeDeadlineExceeded  int32 = -3
+	ErrCodeConnectionLimit   int32 = -4
+	ErrCodeByteLimit         int32 = -5
+	ErrCodeIdleTimeout       int32 = -6
+	ErrCodeLifetimeExceeded  int32 = -7
+	ErrCodePermissionDenied  int32 = -8
+	ErrCodeInvalidArgument   int32 = -9
+	ErrCodeInvalidHandle     int32 = -10
+	ErrCodeHostNotFound      int32 = -11
+	ErrCodeDNS               int32 = -12
+	ErrCodeConnectionRefused int32 = -13
+	ErrCodeConnectionReset   int32 = -14
+	ErrCodeClosed            int32 = -15
+	ErrCodeCanceled          int32 = -16
+	ErrCodeNotRegistered     int32 = -17
+)
+
+// Quota errors.
+var (
+	ErrConnectionLimit  = errors.New("connection limit reached")
+	ErrByteLimit        = errors.New("byte limit reached")
+	ErrIdleTimeout      = errors.New("connection idle timeout")
+	ErrLifetimeExceeded = errors.New("connection lifetime exceeded")
+)
+
+// Host function errors.
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrInvalidHandle    = errors.New("invalid handle")
+	ErrNoHandles        = errors.New("no handles available")
+	ErrNotRegistered    = errors.New("plugin resources are not registered, plugin must be created by wape")
+)
+
+// ErrorCode returns the error code of the error.
+func ErrorCode(err error) int32 {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrCodeEOF
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return ErrCodeDeadlineExceeded
+	case errors.Is(err, ErrConnectionLimit):
+		return ErrCodeConnectionLimit
+	case errors.Is(err, ErrByteLimit):
+		return ErrCodeByteLimit
+	case errors.Is(err, ErrIdleTimeout):
+		return ErrCodeIdleTimeout
+	case errors.Is(err, ErrLifetimeExceeded):
+		return ErrCodeLifetimeExceeded
+	case errors.Is(err, ErrPermissionDenied):
+		return ErrCodePermissionDenied
+	case errors.Is(err, ErrInvalidArgument):
+		return ErrCodeInvalidArgument
+	case errors.Is(err, ErrInvalidHandle):
+		return ErrCodeInvalidHandle
+	case errors.Is(err, ErrNotRegistered):
+		return ErrCodeNotRegistered
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound {
+			return ErrCodeHostNotFound
+		}
+		return ErrCodeDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrCodeConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrCodeConnectionReset
+	case errors.Is(err, net.ErrClosed):
+		return ErrCodeClosed
+	case errors.Is(err, context.Canceled):
+		return ErrCodeCanceled
+	default:
+		return ErrCodeUnknown
+	}
+}
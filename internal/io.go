@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// IOResult is the result of IO operation.
+type IOResult struct {
+	// Done reports whether IO is finished.
+	Done bool
+	// N is the number of bytes processed or the ID of created resource.
+	N int32
+	// Err is the error of IO operation.
+	Err error
+}
+
+// NewIOResult returns the result of finished IO operation.
+func NewIOResult(n int, err error) IOResult {
+	return IOResult{
+		Done: true,
+		N:    int32(n),
+		Err:  err,
+	}
+}
+
+// Code returns the result code of IO: zero if IO is pending, error code if IO failed without processing any bytes,
+// otherwise the number of bytes processed (or ID) plus one, so finished IO is never reported as pending, even if no
+// bytes were processed.
+func (r IOResult) Code() int32 {
+	if !r.Done {
+		return 0
+	}
+	if r.Err != nil && r.N == 0 {
+		return ErrorCode(r.Err)
+	}
+	return r.N + 1
+}
+
+// IOOperation is an asynchronous IO operation.
+//
+// IO never touches guest memory directly, as it can be freed or moved (when memory grows) while IO is pending.
+// Data to write is copied into host memory when IO starts, and read data is staged in host owned buffer and copied
+// into guest memory only once the result is collected by the guest, see [IOOperation.Collect].
+type IOOperation struct {
+	result IOResult
+	done   chan struct{}
+	once   sync.Once
+
+	buffer      []byte
+	destination uint64
+	address     string
+
+	cancel     func()
+	restore    func()
+	canceled   bool
+	returned   bool
+	cancelLock sync.Mutex
+}
+
+// NewIOOperation creates a new pending IO operation.
+func NewIOOperation() *IOOperation {
+	return &IOOperation{
+		done: make(chan struct{}),
+	}
+}
+
+// NewReadOperation creates a new pending read operation with host owned buffer of the size, read data is copied into
+// guest memory at the destination offset once the result is collected.
+func NewReadOperation(destination, size uint64) *IOOperation {
+	return &IOOperation{
+		done:        make(chan struct{}),
+		buffer:      make([]byte, size),
+		destination: destination,
+	}
+}
+
+// Buffer returns host owned buffer of read operation.
+func (o *IOOperation) Buffer() []byte {
+	return o.buffer
+}
+
+// SetAddress sets the address associated with IO (e.g. sender address of a packet), should be called by IO before it
+// returns.
+func (o *IOOperation) SetAddress(address string) {
+	o.cancelLock.Lock()
+	defer o.cancelLock.Unlock()
+	o.address = address
+}
+
+// Address returns the address associated with finished IO, empty if IO is pending or has no address.
+func (o *IOOperation) Address() string {
+	select {
+	case <-o.done:
+	default:
+		return ""
+	}
+
+	o.cancelLock.Lock()
+	defer o.cancelLock.Unlock()
+	return o.address
+}
+
+// Go runs IO in a new goroutine and finishes the operation with its result, panics are reported as errors.
+// Operation is canceled if context is canceled before IO is finished, cancel is called to interrupt the IO, and errors
+// of canceled IO are reported as [context.Canceled]. Restore is called after interrupted IO returns, to undo the
+// effects of cancel. Cancel and restore can be nil if IO can't be interrupted, in that case operation is finished as
+// canceled right away and result of IO is discarded.
+func (o *IOOperation) Go(ctx context.Context, io func() (int, error), cancel, restore func()) {
+	o.cancel = cancel
+	o.restore = restore
+	stop := context.AfterFunc(ctx, o.Cancel)
+
+	go func() {
+		defer stop()
+		defer func() {
+			if r := recover(); r != nil {
+				o.Finish(0, fmt.Errorf("IO panic: %v", r))
+			}
+		}()
+
+		n, err := io()
+
+		o.cancelLock.Lock()
+		o.returned = true
+		canceled := o.canceled
+		o.cancelLock.Unlock()
+
+		if canceled {
+			if o.restore != nil {
+				o.restore()
+			}
+			if err != nil {
+				err = context.Canceled
+			}
+		}
+		o.Finish(n, err)
+	}()
+}
+
+// Cancel cancels pending IO operation, it's safe to call multiple times and after IO is finished.
+func (o *IOOperation) Cancel() {
+	o.cancelLock.Lock()
+	defer o.cancelLock.Unlock()
+
+	if o.returned || o.canceled {
+		return
+	}
+	o.canceled = true
+
+	if o.cancel == nil {
+		o.Finish(0, context.Canceled)
+		return
+	}
+	o.cancel()
+}
+
+// Finish finishes the IO operation with the number of bytes processed (or ID) and error, only the first call has
+// effect.
+func (o *IOOperation) Finish(n int, err error) {
+	o.once.Do(func() {
+		o.result = NewIOResult(n, err)
+		close(o.done)
+	})
+}
+
+// Done returns a channel that is closed once IO operation is finished.
+func (o *IOOperation) Done() <-chan struct{} {
+	return o.done
+}
+
+// Result returns the result of IO operation, result is not done if IO operation is pending.
+func (o *IOOperation) Result() IOResult {
+	select {
+	case <-o.done:
+		return o.result
+	default:
+		return IOResult{}
+	}
+}
+
+// Collect returns the result of IO operation, read data of finished operation is copied into guest memory.
+func (o *IOOperation) Collect(p *extism.CurrentPlugin) IOResult {
+	result := o.Result()
+	if !result.Done || o.buffer == nil || result.N <= 0 {
+		return result
+	}
+
+	if !p.Memory().Write(uint32(o.destination), o.buffer[:result.N]) {
+		return NewIOResult(0, fmt.Errorf("%w: read destination out of range", ErrInvalidArgument))
+	}
+
+	return result
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// ReadString reads a string from plugin memory.
+func ReadString(p *extism.CurrentPlugin, offset uint64) (string, error) {
+	value, err := p.ReadString(offset)
+	if err != nil {
+		return "", fmt.Errorf("%w: read string: %w", ErrInvalidArgument, err)
+	}
+	return value, nil
+}
+
+// ReadLength reads the length of plugin memory block.
+func ReadLength(p *extism.CurrentPlugin, offset uint64) (uint64, error) {
+	length, err := p.Length(offset)
+	if err != nil {
+		return 0, fmt.Errorf("%w: read length: %w", ErrInvalidArgument, err)
+	}
+	return length, nil
+}
+
+// ReadBytes reads bytes from plugin memory, returned bytes share plugin memory, so they must not be used after host
+// function returns, use [CopyBytes] instead.
+func ReadBytes(p *extism.CurrentPlugin, offset uint64) ([]byte, error) {
+	length, err := ReadLength(p, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, ok := p.Memory().Read(uint32(offset), uint32(length))
+	if !ok {
+		return nil, fmt.Errorf("%w: read buffer: out of range", ErrInvalidArgument)
+	}
+
+	return buffer, nil
+}
+
+// CopyBytes reads a copy of bytes from plugin memory.
+func CopyBytes(p *extism.CurrentPlugin, offset uint64) ([]byte, error) {
+	buffer, err := ReadBytes(p, offset)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buffer), nil
+}
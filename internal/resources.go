@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// Resources holds resources owned by a single plugin instance.
+type Resources struct {
+	IOHandles         *Table[*IOOperation]
+	Connections       *Table[net.Conn]
+	Listeners         *Table[net.Listener]
+	PacketConnections *Table[net.PacketConn]
+
+	lastErr     error
+	lastErrLock sync.Mutex
+
+	// err is set for resources of unregistered plugins, every failure is reported with it
+	err error
+
+	closers []io.Closer
+	values  *SyncMap[any, any]
+
+	plugin    *extism.Plugin
+	closeOnce sync.Once
+}
+
+// plugins holds resources of all plugin instances.
+var plugins = NewSyncMap[*extism.Plugin, *Resources]()
+
+// NewResources creates new resources.
+func NewResources() *Resources {
+	return &Resources{
+		IOHandles:         NewTable[*IOOperation](),
+		Connections:       NewTable[net.Conn](),
+		Listeners:         NewTable[net.Listener](),
+		PacketConnections: NewTable[net.PacketConn](),
+		values:            NewSyncMap[any, any](),
+	}
+}
+
+// PluginResources returns resources of the plugin that called the host function. Resources are registered when the
+// plugin is created (see [Resources.Register]), if there are no registered resources (plugin is not created by wape or
+// host function is called outside of plugin call) closed resources are returned, so host functions fail with
+// [ErrNotRegistered] instead of creating resources that are never closed.
+func PluginResources(ctx context.Context) *Resources {
+	plugin, _ := ctx.Value(extism.PluginCtxKey("plugin")).(*extism.Plugin)
+	if resources, ok := plugins.GetOk(plugin); ok {
+		return resources
+	}
+
+	resources := NewResources()
+	resources.err = ErrNotRegistered
+	resources.Close()
+	return resources
+}
+
+// WithResources returns the context that closes resources once any module instantiated with it is closed.
+func WithResources(ctx context.Context, resources *Resources) context.Context {
+	return experimental.WithCloseNotifier(ctx, experimental.CloseNotifyFunc(func(context.Context, uint32) {
+		resources.Close()
+	}))
+}
+
+// Fail records the error as the last error of the plugin and returns its error code. Failures of unregistered plugins
+// are reported as [ErrNotRegistered].
+func (r *Resources) Fail(err error) int32 {
+	if r.err != nil {
+		err = r.err
+	}
+
+	r.lastErrLock.Lock()
+	r.lastErr = err
+	r.lastErrLock.Unlock()
+	return ErrorCode(err)
+}
+
+// LastError returns and clears the last error of the plugin.
+func (r *Resources) LastError() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	r.lastErrLock.Lock()
+	defer r.lastErrLock.Unlock()
+	err := r.lastErr
+	r.lastErr = nil
+	return err
+}
+
+// Value returns the value of the key owned by the plugin, value is created on the first use.
+func (r *Resources) Value(key any, create func() any) any {
+	return r.values.GetOrSet(key, create)
+}
+
+// OnClose adds closers that are closed with resources, must be called before resources are used.
+func (r *Resources) OnClose(closers ...io.Closer) {
+	r.closers = append(r.closers, closers...)
+}
+
+// Register registers resources as resources of the plugin.
+func (r *Resources) Register(plugin *extism.Plugin) {
+	r.plugin = plugin
+	plugins.Set(plugin, r)
+}
+
+// Close closes all resources and unregisters them, it's safe to call multiple times.
+func (r *Resources) Close() {
+	r.closeOnce.Do(func() {
+		if r.plugin != nil {
+			plugins.Delete(r.plugin)
+		}
+
+		r.IOHandles.Close()
+		for _, conn := range r.Connections.Close() {
+			_ = conn.Close()
+		}
+		for _, listener := range r.Listeners.Close() {
+			_ = listener.Close()
+		}
+		for _, packetConn := range r.PacketConnections.Close() {
+			_ = packetConn.Close()
+		}
+		for _, closer := range r.closers {
+			_ = closer.Close()
+		}
+	})
+}
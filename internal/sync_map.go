@@ -38,3 +38,20 @@ func (m *SyncMap[K, _]) Delete(key K) {
 	delete(m.m, key)
 	m.l.Unlock()
 }
+
+func (m *SyncMap[K, V]) GetOrSet(key K, value func() V) V {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if v, ok := m.m[key]; ok {
+		return v
+	}
+	v := value()
+	m.m[key] = v
+	return v
+}
+
+func (m *SyncMap[K, V]) Clear() {
+	m.l.Lock()
+	clear(m.m)
+	m.l.Unlock()
+}
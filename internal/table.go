@@ -0,0 +1,143 @@
+package internal
+
+import "sync"
+
+const (
+	// tableSlotBits is the number of handle bits used for the slot index, the rest is used for the generation.
+	tableSlotBits = 16
+	// tableMaxSlots is the maximum number of values in a table, zero slot index is never used.
+	tableMaxSlots = 1<<tableSlotBits - 1
+	// tableGenerationMask masks generation, so handles are always positive.
+	tableGenerationMask = 1<<(31-tableSlotBits) - 1
+)
+
+// Table is a handle table, handles are allocated sequentially and include a generation counter, so handles of removed
+// values are not valid anymore even when their slot is reused. Handles are always positive.
+type Table[V any] struct {
+	slots  []tableSlot[V]
+	free   []int32
+	closed bool
+	l      sync.Mutex
+}
+
+type tableSlot[V any] struct {
+	value      V
+	generation int32
+	used       bool
+}
+
+// NewTable creates a new table.
+func NewTable[V any]() *Table[V] {
+	return &Table[V]{}
+}
+
+// Add adds the value and returns its handle, returns false if table is closed or full.
+func (t *Table[V]) Add(value V) (int32, bool) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if t.closed {
+		return 0, false
+	}
+
+	var index int32
+	if len(t.free) > 0 {
+		index = t.free[0]
+		t.free = t.free[1:]
+	} else {
+		if len(t.slots) >= tableMaxSlots {
+			return 0, false
+		}
+		index = int32(len(t.slots))
+		t.slots = append(t.slots, tableSlot[V]{})
+	}
+
+	slot := &t.slots[index]
+	slot.value = value
+	slot.used = true
+
+	return slot.generation<<tableSlotBits | (index + 1), true
+}
+
+// Get returns the value by its handle.
+func (t *Table[V]) Get(handle int32) (V, bool) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	slot, ok := t.slot(handle)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	return slot.value, true
+}
+
+// Set replaces the value by its handle, returns false if handle is not valid.
+func (t *Table[V]) Set(handle int32, value V) bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	slot, ok := t.slot(handle)
+	if !ok {
+		return false
+	}
+
+	slot.value = value
+	return true
+}
+
+// Remove removes the value by its handle and returns it.
+func (t *Table[V]) Remove(handle int32) (V, bool) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	var zero V
+	slot, ok := t.slot(handle)
+	if !ok {
+		return zero, false
+	}
+
+	value := slot.value
+	slot.value = zero
+	slot.used = false
+	slot.generation = (slot.generation + 1) & tableGenerationMask
+	t.free = append(t.free, handle&tableMaxSlots-1)
+
+	return value, true
+}
+
+// Close removes all values and returns them, no values can be added after close.
+func (t *Table[V]) Close() []V {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	t.closed = true
+
+	var values []V
+	for _, slot := range t.slots {
+		if slot.used {
+			values = append(values, slot.value)
+		}
+	}
+
+	t.slots = nil
+	t.free = nil
+
+	return values
+}
+
+// slot returns the used slot by its handle, must be called with lock held.
+func (t *Table[V]) slot(handle int32) (*tableSlot[V], bool) {
+	index := handle&tableMaxSlots - 1
+	if handle <= 0 || index < 0 || int(index) >= len(t.slots) {
+		return nil, false
+	}
+
+	slot := &t.slots[index]
+	if !slot.used || slot.generation != handle>>tableSlotBits {
+		return nil, false
+	}
+
+	return slot, true
+}
@@ -4,14 +4,68 @@ import (
 	"context"
 
 	extism "github.com/extism/go-sdk"
+
+	"github.com/mymmrac/wape/internal"
 )
 
-// NewPlugin creates a new Extism plugin.
+// NewPlugin creates a new Extism plugin, returns an error if the network configuration is invalid.
+// Resources opened by the plugin through host functions (connections, listeners, etc.) are closed with the plugin.
 func NewPlugin(ctx context.Context, env *Environment) (*extism.Plugin, error) {
-	return extism.NewPlugin(ctx, env.MakeManifest(), env.MakePluginConfig(), env.MakeHostFunctions())
+	functions, closers, err := env.makeHostFunctions()
+	resources := internal.NewResources()
+	resources.OnClose(closers...)
+	if err != nil {
+		resources.Close()
+		return nil, err
+	}
+
+	plugin, err := extism.NewPlugin(internal.WithResources(ctx, resources), env.MakeManifest(), env.MakePluginConfig(),
+		functions)
+	if err != nil {
+		resources.Close()
+		return nil, err
+	}
+
+	resources.Register(plugin)
+	return plugin, nil
 }
 
-// NewCompiledPlugin creates a new compiled Extism plugin.
+// NewCompiledPlugin creates a new compiled Extism plugin, returns an error if the network configuration is invalid.
+// Resources opened for host functions (like cassette file) are closed with the compiled plugin. Instances must be
+// created with [NewPluginInstance], host functions that open connections, listeners or IO handles fail with the "not
+// registered" error code for instances created with [extism.CompiledPlugin.Instance].
 func NewCompiledPlugin(ctx context.Context, env *Environment) (*extism.CompiledPlugin, error) {
-	return extism.NewCompiledPlugin(ctx, env.MakeManifest(), env.MakePluginConfig(), env.MakeHostFunctions())
+	functions, closers, err := env.makeHostFunctions()
+
+	// Host modules are instantiated with the context, so resources are closed once the compiled plugin is closed
+	resources := internal.NewResources()
+	resources.OnClose(closers...)
+	if err != nil {
+		resources.Close()
+		return nil, err
+	}
+
+	compiled, err := extism.NewCompiledPlugin(internal.WithResources(ctx, resources), env.MakeManifest(),
+		env.MakePluginConfig(), functions)
+	if err != nil {
+		resources.Close()
+		return nil, err
+	}
+
+	return compiled, nil
+}
+
+// NewPluginInstance creates a new instance of the compiled Extism plugin.
+// Resources opened by the plugin through host functions (connections, listeners, etc.) are closed with the plugin,
+// use it instead of [extism.CompiledPlugin.Instance], as resources can't be opened for instances not created by it.
+func NewPluginInstance(ctx context.Context, compiled *extism.CompiledPlugin, env *Environment) (*extism.Plugin, error) {
+	resources := internal.NewResources()
+	plugin, err := compiled.Instance(internal.WithResources(ctx, resources), env.MakePluginInstanceConfig())
+	if err != nil {
+		resources.Close()
+		return nil, err
+	}
+
+	resources.Register(plugin)
+	return plugin, nil
 }
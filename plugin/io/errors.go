@@ -0,0 +1,162 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	goio "io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/extism/go-pdk"
+)
+
+// Error codes returned by the host, must be kept in sync with the host module.
+const (
+	ErrCodeUnknown           int32 = -1
+	ErrCodeEOF               int32 = -2
+	ErrCodeDeadlineExceeded  int32 = -3
+	ErrCodeConnectionLimit   int32 = -4
+	ErrCodeByteLimit         int32 = -5
+	ErrCodeIdleTimeout       int32 = -6
+	ErrCodeLifetimeExceeded  int32 = -7
+	ErrCodePermissionDenied  int32 = -8
+	ErrCodeInvalidArgument   int32 = -9
+	ErrCodeInvalidHandle     int32 = -10
+	ErrCodeHostNotFound      int32 = -11
+	ErrCodeDNS               int32 = -12
+	ErrCodeConnectionRefused int32 = -13
+	ErrCodeConnectionReset   int32 = -14
+	ErrCodeClosed            int32 = -15
+	ErrCodeCanceled          int32 = -16
+	ErrCodeNotRegistered     int32 = -17
+)
+
+// Quota errors reported by the host.
+var (
+	ErrConnectionLimit  = errors.New("connection limit reached")
+	ErrByteLimit        = errors.New("byte limit reached")
+	ErrIdleTimeout      = errors.New("connection idle timeout")
+	ErrLifetimeExceeded = errors.New("connection lifetime exceeded")
+)
+
+// Host function errors reported by the host.
+var (
+	// ErrPermissionDenied is reported when the operation is not allowed by the host configuration, errors that wrap it
+	// also match [os.ErrPermission].
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrInvalidHandle    = errors.New("invalid handle")
+	ErrHostNotFound     = errors.New("no such host")
+	ErrDNS              = errors.New("DNS error")
+	// ErrNotRegistered is reported when the plugin wasn't created by wape on the host, so it can't own resources like
+	// connections and listeners.
+	ErrNotRegistered = errors.New("plugin resources are not registered")
+)
+
+// codeErrors maps error codes to errors.
+var codeErrors = map[int32]error{
+	ErrCodeEOF:               goio.EOF,
+	ErrCodeDeadlineExceeded:  os.ErrDeadlineExceeded,
+	ErrCodeConnectionLimit:   ErrConnectionLimit,
+	ErrCodeByteLimit:         ErrByteLimit,
+	ErrCodeIdleTimeout:       ErrIdleTimeout,
+	ErrCodeLifetimeExceeded:  ErrLifetimeExceeded,
+	ErrCodePermissionDenied:  ErrPermissionDenied,
+	ErrCodeInvalidArgument:   ErrInvalidArgument,
+	ErrCodeInvalidHandle:     ErrInvalidHandle,
+	ErrCodeHostNotFound:      ErrHostNotFound,
+	ErrCodeDNS:               ErrDNS,
+	ErrCodeConnectionRefused: syscall.ECONNREFUSED,
+	ErrCodeConnectionReset:   syscall.ECONNRESET,
+	ErrCodeClosed:            net.ErrClosed,
+	ErrCodeCanceled:          context.Canceled,
+	ErrCodeNotRegistered:     ErrNotRegistered,
+}
+
+// HostError is an error reported by the host, it wraps the error that corresponds to its code.
+type HostError struct {
+	Code    int32
+	Message string
+}
+
+func (e *HostError) Error() string {
+	return e.Message
+}
+
+func (e *HostError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+func (e *HostError) Is(target error) bool {
+	return e.Code == ErrCodePermissionDenied && target == os.ErrPermission
+}
+
+func (e *HostError) Timeout() bool {
+	return e.Code == ErrCodeDeadlineExceeded || e.Code == ErrCodeIdleTimeout
+}
+
+// Error returns the error that corresponds to the error code. [goio.EOF] and [os.ErrDeadlineExceeded] are returned
+// as is, other errors are returned as [HostError] with the message of the last host error if it matches the code.
+func Error(code int32) error {
+	switch code {
+	case ErrCodeEOF:
+		return goio.EOF
+	case ErrCodeDeadlineExceeded:
+		return os.ErrDeadlineExceeded
+	}
+
+	lastCode, message, ok := lastError()
+	if !ok || lastCode != code {
+		message = fmt.Sprintf("io error: %d", code)
+		if err, found := codeErrors[code]; found {
+			message = err.Error()
+		}
+	}
+
+	return &HostError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// LastError returns the last error reported by the host, used for host functions that don't return error codes.
+func LastError() error {
+	code, message, ok := lastError()
+	if !ok {
+		return &HostError{
+			Code:    ErrCodeUnknown,
+			Message: "unknown error",
+		}
+	}
+
+	return &HostError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+//go:wasmimport wape:host/env io.lastError
+func _lastError() uint64
+
+// lastError returns and clears the last error reported by the host.
+func lastError() (int32, string, bool) {
+	errPtr := _lastError()
+	if errPtr == 0 {
+		return 0, "", false
+	}
+
+	errMem := pdk.FindMemory(errPtr)
+	defer errMem.Free()
+
+	codeStr, message, _ := strings.Cut(string(errMem.ReadBytes()), " ")
+	code, err := strconv.ParseInt(codeStr, 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return int32(code), message, true
+}
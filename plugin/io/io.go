@@ -1,28 +1,126 @@
 package io
 
-import "time"
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"time"
 
-// DefaultDelay is the default delay for [Ready]
+	"github.com/extism/go-pdk"
+)
+
+// DefaultDelay is the default maximum time [Ready] blocks in the host before letting other goroutines run.
 var DefaultDelay = time.Millisecond
 
 //go:wasmimport wape:host/env io.ready
 func _ready(handle int32) int32
 
-// Ready returns the number of bytes ready to be read/written or negative number in case of error.
-// Waits for the [DefaultDelay] between each check of the handle.
+//go:wasmimport wape:host/env io.wait
+func _wait(handle int32, timeout int64) int32
+
+//go:wasmimport wape:host/env io.poll
+func _poll(handles uint64, timeout int64) int32
+
+//go:wasmimport wape:host/env io.cancel
+func _cancel(handle int32) int32
+
+// Ready returns the number of bytes ready to be read/written (or ID of created resource) or negative number in case
+// of error. Blocks in the host for up to [DefaultDelay] at a time, other goroutines are run in between.
 func Ready(handle int32) int32 {
 	return ReadyWithDelay(handle, DefaultDelay)
 }
 
 // ReadyWithDelay returns the number of bytes ready to be read/written or negative number in case of error.
-// Waits for the specified delay between each check of the handle.
+// Blocks in the host for up to the specified delay at a time, other goroutines are run in between.
 func ReadyWithDelay(handle int32, delay time.Duration) int32 {
-	var result int32
 	for {
-		result = _ready(handle)
-		if result != 0 {
-			return result
+		if code := _wait(handle, int64(delay)); code != 0 {
+			return result(code)
+		}
+		runtime.Gosched()
+	}
+}
+
+// ReadyContext returns the same result as [Ready], IO is canceled if the context is done before IO is finished.
+// Result of canceled IO is still returned, usually it's [ErrCodeCanceled] error code.
+func ReadyContext(ctx context.Context, handle int32) int32 {
+	done := ctx.Done()
+	for {
+		if code := _wait(handle, int64(DefaultDelay)); code != 0 {
+			return result(code)
+		}
+
+		select {
+		case <-done:
+			_ = Cancel(handle)
+			done = nil
+		default:
+		}
+
+		runtime.Gosched()
+	}
+}
+
+// WaitDone blocks until IO is finished without collecting its result, the result still has to be collected with
+// [Ready]. Blocks in the host for up to [DefaultDelay] at a time, other goroutines are run in between.
+func WaitDone(handle int32) error {
+	handles := []int32{handle}
+	for {
+		_, err := Poll(handles, DefaultDelay)
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return err
 		}
-		time.Sleep(delay)
+		runtime.Gosched()
 	}
 }
+
+// Cancel cancels pending IO, interrupting it if possible. Result of canceled IO still has to be collected with
+// [Ready], canceling finished IO has no effect.
+func Cancel(handle int32) error {
+	if code := _cancel(handle); code < 0 {
+		return Error(code)
+	}
+	return nil
+}
+
+// Wait blocks until IO is finished or timeout expires, returns the same result as [Ready] and true if IO is finished,
+// false if timeout expired. Zero timeout doesn't block and negative timeout means no timeout. Other goroutines are not
+// run while waiting.
+func Wait(handle int32, timeout time.Duration) (int32, bool) {
+	code := _wait(handle, int64(timeout))
+	if code == 0 {
+		return 0, false
+	}
+	return result(code), true
+}
+
+// result decodes the result code of finished IO, the number of bytes processed (or ID) is encoded by the host plus
+// one, so zero always means pending IO.
+func result(code int32) int32 {
+	if code > 0 {
+		return code - 1
+	}
+	return code
+}
+
+// Poll blocks until any of IO operations is finished or timeout expires, returns the index of the first finished
+// handle. Handles are not consumed, use [Ready] to get the result of the finished IO. Timeout is used the same way as
+// for [Wait], [os.ErrDeadlineExceeded] is returned if it expires.
+func Poll(handles []int32, timeout time.Duration) (int, error) {
+	handlesData := make([]byte, 4*len(handles))
+	for i, handle := range handles {
+		binary.LittleEndian.PutUint32(handlesData[4*i:], uint32(handle))
+	}
+
+	handlesMem := pdk.AllocateBytes(handlesData)
+	defer handlesMem.Free()
+
+	index := _poll(handlesMem.Offset(), int64(timeout))
+	if index < 0 {
+		return 0, Error(index)
+	}
+
+	return int(index), nil
+}
@@ -0,0 +1,54 @@
+package net
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/extism/go-pdk"
+)
+
+// addr is a generic network address.
+type addr struct {
+	network string
+	address string
+}
+
+func (a *addr) Network() string {
+	return a.network
+}
+
+func (a *addr) String() string {
+	return a.address
+}
+
+// parseAddr returns typed network address if possible, generic one otherwise.
+func parseAddr(network, address string) net.Addr {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		if addrPort, err := netip.ParseAddrPort(address); err == nil {
+			return net.TCPAddrFromAddrPort(addrPort)
+		}
+	case "udp", "udp4", "udp6":
+		if addrPort, err := netip.ParseAddrPort(address); err == nil {
+			return net.UDPAddrFromAddrPort(addrPort)
+		}
+	case "unix", "unixgram", "unixpacket":
+		return &net.UnixAddr{Name: address, Net: network}
+	}
+
+	return &addr{
+		network: network,
+		address: address,
+	}
+}
+
+// readAddr reads address encoded as network and address separated by a space, returns empty address for zero pointer.
+func readAddr(addrPtr uint64) net.Addr {
+	if addrPtr == 0 {
+		return &addr{}
+	}
+
+	network, address, _ := strings.Cut(pdk.ParamString(addrPtr), " ")
+	return parseAddr(network, address)
+}
@@ -1,7 +1,6 @@
 package net
 
 import (
-	"fmt"
 	"net"
 	"time"
 
@@ -11,24 +10,30 @@ import (
 )
 
 type Conn struct {
-	connID int32
+	connID     int32
+	localAddr  net.Addr
+	remoteAddr net.Addr
 }
 
 //go:wasmimport wape:host/env net.conn.read
 func _read(connID int32, data uint64) int32
 
 func (c *Conn) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
 	dataMem := pdk.Allocate(len(b))
 	defer dataMem.Free()
 
 	handle := _read(c.connID, dataMem.Offset())
 	if handle < 0 {
-		return 0, fmt.Errorf("failed to start read: %d", handle)
+		return 0, c.opError("read", handle)
 	}
 
 	readBytes := io.Ready(handle)
 	if readBytes < 0 {
-		return 0, fmt.Errorf("failed to read: %d", readBytes)
+		return 0, c.opError("read", readBytes)
 	}
 
 	dataMem.Load(b[:readBytes])
@@ -39,17 +44,21 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 func _write(connID int32, data uint64) int32
 
 func (c *Conn) Write(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
 	dataMem := pdk.AllocateBytes(b)
 	defer dataMem.Free()
 
 	handle := _write(c.connID, dataMem.Offset())
 	if handle < 0 {
-		return 0, fmt.Errorf("failed to start write: %d", handle)
+		return 0, c.opError("write", handle)
 	}
 
 	writeBytes := io.Ready(handle)
 	if writeBytes < 0 {
-		return 0, fmt.Errorf("failed to write: %d", writeBytes)
+		return 0, c.opError("write", writeBytes)
 	}
 
 	return int(writeBytes), nil
@@ -61,27 +70,146 @@ func _close(connID int32) int32
 func (c *Conn) Close() error {
 	result := _close(c.connID)
 	if result < 0 {
-		return fmt.Errorf("failed to close: %d", result)
+		return c.opError("close", result)
 	}
 	return nil
 }
 
+//go:wasmimport wape:host/env net.conn.localAddr
+func _localAddr(connID int32) uint64
+
 func (c *Conn) LocalAddr() net.Addr {
-	return nil
+	if c.localAddr == nil {
+		c.localAddr = readAddr(_localAddr(c.connID))
+	}
+	return c.localAddr
 }
 
+//go:wasmimport wape:host/env net.conn.remoteAddr
+func _remoteAddr(connID int32) uint64
+
 func (c *Conn) RemoteAddr() net.Addr {
-	return nil
+	if c.remoteAddr == nil {
+		c.remoteAddr = readAddr(_remoteAddr(c.connID))
+	}
+	return c.remoteAddr
+}
+
+//go:wasmimport wape:host/env net.conn.setDeadline
+func _setDeadline(connID int32, mode int32, timeout int64) int32
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeReadWrite, t)
 }
 
-func (c *Conn) SetDeadline(_ time.Time) error {
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeRead, t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeWrite, t)
+}
+
+func (c *Conn) setDeadline(mode int32, t time.Time) error {
+	result := _setDeadline(c.connID, mode, deadlineTimeout(t))
+	if result < 0 {
+		return c.opError("set", result)
+	}
 	return nil
 }
 
-func (c *Conn) SetReadDeadline(_ time.Time) error {
+// Connection options, must be kept in sync with the host module.
+const (
+	connOptionNoDelay         int32 = 0
+	connOptionKeepAlive       int32 = 1
+	connOptionKeepAlivePeriod int32 = 2
+	connOptionLinger          int32 = 3
+	connOptionReadBuffer      int32 = 4
+	connOptionWriteBuffer     int32 = 5
+)
+
+//go:wasmimport wape:host/env net.conn.setOption
+func _setOption(connID int32, option int32, value int64) int32
+
+// SetNoDelay controls whether the operating system should delay packet transmission, see [net.TCPConn.SetNoDelay].
+func (c *Conn) SetNoDelay(noDelay bool) error {
+	return c.setOption(connOptionNoDelay, boolValue(noDelay))
+}
+
+// SetKeepAlive sets whether the operating system should send keep-alive messages on the connection, see
+// [net.TCPConn.SetKeepAlive].
+func (c *Conn) SetKeepAlive(keepalive bool) error {
+	return c.setOption(connOptionKeepAlive, boolValue(keepalive))
+}
+
+// SetKeepAlivePeriod sets the duration the connection needs to remain idle before keep-alive probes are sent, see
+// [net.TCPConn.SetKeepAlivePeriod].
+func (c *Conn) SetKeepAlivePeriod(d time.Duration) error {
+	return c.setOption(connOptionKeepAlivePeriod, int64(d))
+}
+
+// SetLinger sets the behavior of Close on a connection which still has data waiting to be sent, see
+// [net.TCPConn.SetLinger].
+func (c *Conn) SetLinger(sec int) error {
+	return c.setOption(connOptionLinger, int64(sec))
+}
+
+// SetReadBuffer sets the size of the operating system's receive buffer, see [net.TCPConn.SetReadBuffer].
+func (c *Conn) SetReadBuffer(bytes int) error {
+	return c.setOption(connOptionReadBuffer, int64(bytes))
+}
+
+// SetWriteBuffer sets the size of the operating system's transmit buffer, see [net.TCPConn.SetWriteBuffer].
+func (c *Conn) SetWriteBuffer(bytes int) error {
+	return c.setOption(connOptionWriteBuffer, int64(bytes))
+}
+
+func (c *Conn) setOption(option int32, value int64) error {
+	result := _setOption(c.connID, option, value)
+	if result < 0 {
+		return c.opError("set", result)
+	}
 	return nil
 }
 
-func (c *Conn) SetWriteDeadline(_ time.Time) error {
+// boolValue returns option value of the boolean.
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Shutdown modes, must be kept in sync with the host module.
+const (
+	shutdownModeRead  int32 = 1
+	shutdownModeWrite int32 = 2
+)
+
+//go:wasmimport wape:host/env net.conn.shutdown
+func _shutdown(connID int32, mode int32) int32
+
+// CloseRead shuts down the reading side of the connection, see [net.TCPConn.CloseRead]. Like socket options, half-close
+// must be allowed by the host.
+func (c *Conn) CloseRead() error {
+	return c.shutdown(shutdownModeRead)
+}
+
+// CloseWrite shuts down the writing side of the connection, see [net.TCPConn.CloseWrite].
+func (c *Conn) CloseWrite() error {
+	return c.shutdown(shutdownModeWrite)
+}
+
+func (c *Conn) shutdown(mode int32) error {
+	result := _shutdown(c.connID, mode)
+	if result < 0 {
+		return c.opError("close", result)
+	}
 	return nil
 }
+
+// opError returns the error of the connection operation for the error code.
+func (c *Conn) opError(op string, code int32) error {
+	err := io.Error(code)
+	return opError(op, c.LocalAddr().Network(), c.LocalAddr(), c.RemoteAddr(), err)
+}
@@ -0,0 +1,25 @@
+package net
+
+import "time"
+
+// Deadline modes, must be kept in sync with the host module.
+const (
+	deadlineModeReadWrite int32 = 0
+	deadlineModeRead      int32 = 1
+	deadlineModeWrite     int32 = 2
+)
+
+// deadlineTimeout returns deadline as a timeout in nanoseconds relative to now, zero means no deadline and negative
+// value means already expired deadline.
+func deadlineTimeout(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	timeout := time.Until(t)
+	if timeout <= 0 {
+		return -1
+	}
+
+	return int64(timeout)
+}
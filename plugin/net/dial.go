@@ -2,7 +2,6 @@ package net
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"time"
 
@@ -24,21 +23,80 @@ func (d *Dialer) DialTimeout(network, address string, timeout time.Duration) (ne
 }
 
 //go:wasmimport wape:host/env net.dial
-func _dial(network, addr uint64) int32
+func _dial(network, addr uint64, timeout int64) int32
+
+// DialContext connects to the address on the named network. Deadline of the context is used as dial timeout by the
+// host, as dial blocks the plugin, cancellation of the context is only checked before dial.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout, err := dialTimeout(ctx)
+	if err != nil {
+		return nil, opError("dial", network, nil, parseAddr(network, addr), err)
+	}
 
-func (d *Dialer) DialContext(_ context.Context, network, addr string) (net.Conn, error) {
 	networkMem := pdk.AllocateString(network)
 	defer networkMem.Free()
 
 	addrMem := pdk.AllocateString(addr)
 	defer addrMem.Free()
 
-	connID := _dial(networkMem.Offset(), addrMem.Offset())
+	connID := _dial(networkMem.Offset(), addrMem.Offset(), timeout)
 	if connID < 0 {
-		return nil, fmt.Errorf("failed to dial: %d", connID)
+		return nil, dialError("dial", network, addr, connID)
 	}
 
 	return &Conn{
 		connID: connID,
 	}, nil
 }
+
+// DialTLS connects to the address on the named network using TLS, see [Dialer.DialTLSContext].
+func DialTLS(network, addr string) (net.Conn, error) {
+	return DefaultDialer.DialTLSContext(context.Background(), network, addr)
+}
+
+//go:wasmimport wape:host/env net.dialTLS
+func _dialTLS(network, addr uint64, timeout int64) int32
+
+// DialTLSContext connects to the address on the named network using TLS. TLS handshake is performed by the host,
+// returned connection is a plaintext stream. Context is used the same way as for [Dialer.DialContext].
+func (d *Dialer) DialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout, err := dialTimeout(ctx)
+	if err != nil {
+		return nil, opError("dial", network, nil, parseAddr(network, addr), err)
+	}
+
+	networkMem := pdk.AllocateString(network)
+	defer networkMem.Free()
+
+	addrMem := pdk.AllocateString(addr)
+	defer addrMem.Free()
+
+	connID := _dialTLS(networkMem.Offset(), addrMem.Offset(), timeout)
+	if connID < 0 {
+		return nil, dialError("dial", network, addr, connID)
+	}
+
+	return &Conn{
+		connID: connID,
+	}, nil
+}
+
+// dialTimeout returns dial timeout in nanoseconds based on the context deadline, zero means no timeout.
+// Error is returned if the context is already done.
+func dialTimeout(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+
+	timeout := deadlineTimeout(deadline)
+	if timeout < 0 {
+		return 0, context.DeadlineExceeded
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,59 @@
+package net
+
+import (
+	"errors"
+	goio "io"
+	"net"
+
+	"github.com/mymmrac/wape/plugin/io"
+)
+
+// ErrPermissionDenied is returned when the operation is not allowed by the host configuration.
+var ErrPermissionDenied = io.ErrPermissionDenied
+
+// opError wraps the error into [net.OpError], [goio.EOF] is returned as is.
+func opError(op, network string, source, addr net.Addr, err error) error {
+	if errors.Is(err, goio.EOF) {
+		return err
+	}
+
+	return &net.OpError{
+		Op:     op,
+		Net:    network,
+		Source: source,
+		Addr:   addr,
+		Err:    err,
+	}
+}
+
+// dialError returns the error of dial or listen operation for the error code, DNS errors are wrapped into
+// [net.DNSError].
+func dialError(op, network, address string, code int32) error {
+	err := io.Error(code)
+	if code == io.ErrCodeHostNotFound || code == io.ErrCodeDNS {
+		host, _, splitErr := net.SplitHostPort(address)
+		if splitErr != nil {
+			host = address
+		}
+		return opError(op, network, nil, nil, dnsError(host, err))
+	}
+
+	return opError(op, network, nil, parseAddr(network, address), err)
+}
+
+// dnsError wraps the error into [net.DNSError].
+func dnsError(name string, err error) *net.DNSError {
+	dnsErr := &net.DNSError{
+		UnwrapErr: err,
+		Err:       err.Error(),
+		Name:      name,
+	}
+
+	var hostErr *io.HostError
+	if errors.As(err, &hostErr) {
+		dnsErr.IsNotFound = hostErr.Code == io.ErrCodeHostNotFound
+		dnsErr.IsTimeout = hostErr.Code == io.ErrCodeDeadlineExceeded
+	}
+
+	return dnsErr
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	gohttp "net/http"
+
+	"github.com/extism/go-pdk"
+
+	wio "github.com/mymmrac/wape/plugin/io"
+)
+
+// DefaultTransport is the default [Transport].
+var DefaultTransport = &Transport{}
+
+// DefaultClient is the default HTTP client that uses [DefaultTransport].
+var DefaultClient = &gohttp.Client{
+	Transport: DefaultTransport,
+}
+
+// Transport is an [gohttp.RoundTripper] that executes requests on the host, TLS is handled by the host as well.
+type Transport struct{}
+
+// request is the HTTP request sent to the host.
+type request struct {
+	Method string        `json:"method"`
+	URL    string        `json:"url"`
+	Header gohttp.Header `json:"header,omitempty"`
+	Body   []byte        `json:"body,omitempty"`
+}
+
+// response is the HTTP response returned by the host.
+type response struct {
+	StatusCode int           `json:"statusCode"`
+	Header     gohttp.Header `json:"header,omitempty"`
+	Body       []byte        `json:"body,omitempty"`
+}
+
+//go:wasmimport wape:host/env http.do
+func _do(request uint64) uint64
+
+func (t *Transport) RoundTrip(req *gohttp.Request) (*gohttp.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	requestData, err := json.Marshal(request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	requestMem := pdk.AllocateBytes(requestData)
+	defer requestMem.Free()
+
+	responsePtr := _do(requestMem.Offset())
+	if responsePtr == 0 {
+		return nil, fmt.Errorf("failed to do request: %w", wio.LastError())
+	}
+
+	responseMem := pdk.FindMemory(responsePtr)
+	defer responseMem.Free()
+
+	var resp response
+	if err = json.Unmarshal(responseMem.ReadBytes(), &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.Header == nil {
+		resp.Header = make(gohttp.Header)
+	}
+
+	return &gohttp.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, gohttp.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        resp.Header,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package net
+
+import (
+	"net"
+
+	"github.com/extism/go-pdk"
+
+	"github.com/mymmrac/wape/plugin/io"
+)
+
+type Listener struct {
+	listenerID int32
+	addr       net.Addr
+}
+
+//go:wasmimport wape:host/env net.listen
+func _listen(network, addr uint64) int32
+
+// Listen announces on the local network address, see [net.Listen].
+func Listen(network, address string) (net.Listener, error) {
+	networkMem := pdk.AllocateString(network)
+	defer networkMem.Free()
+
+	addrMem := pdk.AllocateString(address)
+	defer addrMem.Free()
+
+	listenerID := _listen(networkMem.Offset(), addrMem.Offset())
+	if listenerID < 0 {
+		return nil, dialError("listen", network, address, listenerID)
+	}
+
+	return &Listener{
+		listenerID: listenerID,
+	}, nil
+}
+
+//go:wasmimport wape:host/env net.listener.accept
+func _accept(listenerID int32) int32
+
+func (l *Listener) Accept() (net.Conn, error) {
+	handle := _accept(l.listenerID)
+	if handle < 0 {
+		return nil, l.opError("accept", handle)
+	}
+
+	connID := io.Ready(handle)
+	if connID < 0 {
+		return nil, l.opError("accept", connID)
+	}
+
+	return &Conn{
+		connID: connID,
+	}, nil
+}
+
+//go:wasmimport wape:host/env net.listener.close
+func _listenerClose(listenerID int32) int32
+
+func (l *Listener) Close() error {
+	result := _listenerClose(l.listenerID)
+	if result < 0 {
+		return l.opError("close", result)
+	}
+	return nil
+}
+
+//go:wasmimport wape:host/env net.listener.addr
+func _listenerAddr(listenerID int32) uint64
+
+func (l *Listener) Addr() net.Addr {
+	if l.addr == nil {
+		l.addr = readAddr(_listenerAddr(l.listenerID))
+	}
+	return l.addr
+}
+
+// opError returns the error of the listener operation for the error code.
+func (l *Listener) opError(op string, code int32) error {
+	err := io.Error(code)
+	addr := l.Addr()
+	return opError(op, addr.Network(), nil, addr, err)
+}
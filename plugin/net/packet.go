@@ -0,0 +1,145 @@
+package net
+
+import (
+	"net"
+	"time"
+
+	"github.com/extism/go-pdk"
+
+	"github.com/mymmrac/wape/plugin/io"
+)
+
+type PacketConn struct {
+	packetConnID int32
+	network      string
+	addr         net.Addr
+}
+
+//go:wasmimport wape:host/env net.listenPacket
+func _listenPacket(network, addr uint64) int32
+
+// ListenPacket announces on the local network address, see [net.ListenPacket].
+func ListenPacket(network, address string) (net.PacketConn, error) {
+	networkMem := pdk.AllocateString(network)
+	defer networkMem.Free()
+
+	addrMem := pdk.AllocateString(address)
+	defer addrMem.Free()
+
+	packetConnID := _listenPacket(networkMem.Offset(), addrMem.Offset())
+	if packetConnID < 0 {
+		return nil, dialError("listen", network, address, packetConnID)
+	}
+
+	return &PacketConn{
+		packetConnID: packetConnID,
+		network:      network,
+	}, nil
+}
+
+//go:wasmimport wape:host/env net.packetConn.readFrom
+func _readFrom(packetConnID int32, data uint64) int32
+
+//go:wasmimport wape:host/env net.packetConn.readFromAddress
+func _readFromAddress(handle int32) uint64
+
+func (c *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	dataMem := pdk.Allocate(len(b))
+	defer dataMem.Free()
+
+	handle := _readFrom(c.packetConnID, dataMem.Offset())
+	if handle < 0 {
+		return 0, nil, c.opError("read", nil, handle)
+	}
+
+	// Sender address is kept by the host until the result is collected
+	if err = io.WaitDone(handle); err != nil {
+		return 0, nil, opError("read", c.network, c.LocalAddr(), nil, err)
+	}
+	addrPtr := _readFromAddress(handle)
+
+	readBytes := io.Ready(handle)
+	if readBytes < 0 {
+		return 0, nil, c.opError("read", nil, readBytes)
+	}
+
+	if addrPtr == 0 {
+		return 0, nil, opError("read", c.network, c.LocalAddr(), nil, io.ErrInvalidArgument)
+	}
+
+	dataMem.Load(b[:readBytes])
+	return int(readBytes), parseAddr(c.network, pdk.ParamString(addrPtr)), nil
+}
+
+//go:wasmimport wape:host/env net.packetConn.writeTo
+func _writeTo(packetConnID int32, data, addr uint64) int32
+
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	dataMem := pdk.AllocateBytes(b)
+	defer dataMem.Free()
+
+	addrMem := pdk.AllocateString(addr.String())
+	defer addrMem.Free()
+
+	handle := _writeTo(c.packetConnID, dataMem.Offset(), addrMem.Offset())
+	if handle < 0 {
+		return 0, c.opError("write", addr, handle)
+	}
+
+	writeBytes := io.Ready(handle)
+	if writeBytes < 0 {
+		return 0, c.opError("write", addr, writeBytes)
+	}
+
+	return int(writeBytes), nil
+}
+
+//go:wasmimport wape:host/env net.packetConn.close
+func _packetConnClose(packetConnID int32) int32
+
+func (c *PacketConn) Close() error {
+	result := _packetConnClose(c.packetConnID)
+	if result < 0 {
+		return c.opError("close", nil, result)
+	}
+	return nil
+}
+
+//go:wasmimport wape:host/env net.packetConn.localAddr
+func _packetConnLocalAddr(packetConnID int32) uint64
+
+func (c *PacketConn) LocalAddr() net.Addr {
+	if c.addr == nil {
+		c.addr = readAddr(_packetConnLocalAddr(c.packetConnID))
+	}
+	return c.addr
+}
+
+//go:wasmimport wape:host/env net.packetConn.setDeadline
+func _packetConnSetDeadline(packetConnID int32, mode int32, timeout int64) int32
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeReadWrite, t)
+}
+
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeRead, t)
+}
+
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(deadlineModeWrite, t)
+}
+
+func (c *PacketConn) setDeadline(mode int32, t time.Time) error {
+	result := _packetConnSetDeadline(c.packetConnID, mode, deadlineTimeout(t))
+	if result < 0 {
+		return c.opError("set", nil, result)
+	}
+	return nil
+}
+
+// opError returns the error of the packet connection operation for the error code.
+func (c *PacketConn) opError(op string, addr net.Addr, code int32) error {
+	err := io.Error(code)
+	return opError(op, c.network, c.LocalAddr(), addr, err)
+}
@@ -2,10 +2,12 @@ package net
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"encoding/json"
+	"net"
 
 	"github.com/extism/go-pdk"
+
+	"github.com/mymmrac/wape/plugin/io"
 )
 
 var DefaultResolver = &Resolver{}
@@ -19,11 +21,109 @@ func (r *Resolver) LookupHost(_ context.Context, host string) ([]string, error)
 	hostMem := pdk.AllocateString(host)
 	defer hostMem.Free()
 
-	addressesPtr := _lookupHost(hostMem.Offset())
-	if addressesPtr < 0 {
-		return nil, fmt.Errorf("failed to lookup host: %d", addressesPtr)
+	var addresses []string
+	if err := readJSON(_lookupHost(hostMem.Offset()), &addresses); err != nil {
+		return nil, dnsError(host, err)
+	}
+
+	return addresses, nil
+}
+
+//go:wasmimport wape:host/env net.resolver.lookupIP
+func _lookupIP(network, host uint64) uint64
+
+func (r *Resolver) LookupIP(_ context.Context, network, host string) ([]net.IP, error) {
+	networkMem := pdk.AllocateString(network)
+	defer networkMem.Free()
+
+	hostMem := pdk.AllocateString(host)
+	defer hostMem.Free()
+
+	var ips []net.IP
+	if err := readJSON(_lookupIP(networkMem.Offset(), hostMem.Offset()), &ips); err != nil {
+		return nil, dnsError(host, err)
+	}
+
+	return ips, nil
+}
+
+//go:wasmimport wape:host/env net.resolver.lookupSRV
+func _lookupSRV(service, proto, name uint64) uint64
+
+func (r *Resolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	serviceMem := pdk.AllocateString(service)
+	defer serviceMem.Free()
+
+	protoMem := pdk.AllocateString(proto)
+	defer protoMem.Free()
+
+	nameMem := pdk.AllocateString(name)
+	defer nameMem.Free()
+
+	var result struct {
+		CNAME string     `json:"cname"`
+		Addrs []*net.SRV `json:"addrs"`
+	}
+	if err := readJSON(_lookupSRV(serviceMem.Offset(), protoMem.Offset(), nameMem.Offset()), &result); err != nil {
+		return "", nil, dnsError(name, err)
+	}
+
+	return result.CNAME, result.Addrs, nil
+}
+
+//go:wasmimport wape:host/env net.resolver.lookupTXT
+func _lookupTXT(name uint64) uint64
+
+func (r *Resolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	nameMem := pdk.AllocateString(name)
+	defer nameMem.Free()
+
+	var records []string
+	if err := readJSON(_lookupTXT(nameMem.Offset()), &records); err != nil {
+		return nil, dnsError(name, err)
+	}
+
+	return records, nil
+}
+
+//go:wasmimport wape:host/env net.resolver.lookupMX
+func _lookupMX(name uint64) uint64
+
+func (r *Resolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	nameMem := pdk.AllocateString(name)
+	defer nameMem.Free()
+
+	var records []*net.MX
+	if err := readJSON(_lookupMX(nameMem.Offset()), &records); err != nil {
+		return nil, dnsError(name, err)
+	}
+
+	return records, nil
+}
+
+//go:wasmimport wape:host/env net.resolver.lookupCNAME
+func _lookupCNAME(host uint64) uint64
+
+func (r *Resolver) LookupCNAME(_ context.Context, host string) (string, error) {
+	hostMem := pdk.AllocateString(host)
+	defer hostMem.Free()
+
+	var cname string
+	if err := readJSON(_lookupCNAME(hostMem.Offset()), &cname); err != nil {
+		return "", dnsError(host, err)
 	}
 
-	addresses := pdk.ParamString(addressesPtr)
-	return strings.Split(addresses, ","), nil
+	return cname, nil
+}
+
+// readJSON decodes JSON value written by the host, returns the last host error for zero pointer.
+func readJSON(ptr uint64, v any) error {
+	if ptr == 0 {
+		return io.LastError()
+	}
+
+	mem := pdk.FindMemory(ptr)
+	defer mem.Free()
+
+	return json.Unmarshal(mem.ReadBytes(), v)
 }